@@ -5,6 +5,7 @@ import (
 	"lazysync/application/server"
 	"lazysync/application/service"
 	"lazysync/modules"
+	"log/slog"
 )
 
 type App interface {
@@ -12,13 +13,18 @@ type App interface {
 	Run()
 	GetType() string
 	SetMode(module modules.Module)
+	SetLogger(logger *slog.Logger)
 }
 
 func InitFromConfig() App {
-	config := service.LoadConfiguration()
+	return InitFromConfiguration(service.LoadConfiguration())
+}
+
+// InitFromConfiguration creates the application for the role set in an already loaded configuration.
+func InitFromConfiguration(config *service.AppConfiguration) App {
 	switch config.Mode {
 	case server.Type:
-		return &server.Server{Configuration: config, ActiveSessions: map[string][]byte{}}
+		return &server.Server{Configuration: config}
 	case client.Type:
 		return &client.Client{Configuration: config, JWTToken: ""}
 	}
@@ -0,0 +1,141 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+const DefaultPath = "audit.log"
+
+const EventLoginSuccess = "login_success"
+
+const EventLoginFailure = "login_failure"
+
+const EventTokenIssued = "token_issued"
+
+const EventTokenRefreshed = "token_refreshed"
+
+const EventTokenRevoked = "token_revoked"
+
+const EventSyncRequest = "sync_request"
+
+const EventFileServed = "file_served"
+
+// EventTypes lists every recorded event type.
+var EventTypes = []string{
+	EventLoginSuccess,
+	EventLoginFailure,
+	EventTokenIssued,
+	EventTokenRefreshed,
+	EventTokenRevoked,
+	EventSyncRequest,
+	EventFileServed,
+}
+
+// Event is a single audit record, stored as one JSON object per line.
+type Event struct {
+	Time       time.Time `json:"time"`
+	Type       string    `json:"event"`
+	Username   string    `json:"user,omitempty"`
+	RemoteAddr string    `json:"remote_addr,omitempty"`
+	Module     string    `json:"module,omitempty"`
+	File       string    `json:"file,omitempty"`
+	Size       int64     `json:"size,omitempty"`
+	Hash       string    `json:"hash,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// Log appends events to the audit file. A nil Log discards every event, so callers do not
+// have to check whether auditing is enabled.
+type Log struct {
+	lock sync.Mutex
+	file *os.File
+}
+
+// Open opens the audit file for appending, creating it if needed.
+func Open(path string) (*Log, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &Log{file: file}, nil
+}
+
+// Record stamps the event with the current time, unless already set, and appends it.
+// Audit failures never interrupt the audited operation, they are returned for reporting only.
+func (l *Log) Record(event Event) error {
+	if l == nil {
+		return nil
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	_, err = l.file.Write(append(line, '\n'))
+	return err
+}
+
+func (l *Log) Close() error {
+	if l == nil {
+		return nil
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.file.Close()
+}
+
+// Filter selects events, zero fields match everything.
+type Filter struct {
+	Username string
+	Types    []string
+	Since    time.Time
+	Until    time.Time
+}
+
+func (f *Filter) Matches(event *Event) bool {
+	if f.Username != "" && event.Username != f.Username {
+		return false
+	}
+	if len(f.Types) > 0 && !slices.Contains(f.Types, event.Type) {
+		return false
+	}
+	if !f.Since.IsZero() && event.Time.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && event.Time.After(f.Until) {
+		return false
+	}
+	return true
+}
+
+// Read returns the events of the audit file matching the filter, in the order they were recorded.
+func Read(path string, filter Filter) ([]Event, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var events []Event
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var event Event
+		if json.Unmarshal(scanner.Bytes(), &event) != nil {
+			// Skip a line torn by a crash, the rest of the log is still valid.
+			continue
+		}
+		if filter.Matches(&event) {
+			events = append(events, event)
+		}
+	}
+	return events, scanner.Err()
+}
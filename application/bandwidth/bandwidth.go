@@ -0,0 +1,239 @@
+package bandwidth
+
+import (
+	"context"
+	"fmt"
+	"golang.org/x/time/rate"
+	"gopkg.in/yaml.v3"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// chunkSize is the largest amount of data passed through a limiter at once.
+const chunkSize = 32 * 1024
+
+var units = []struct {
+	suffix string
+	factor float64
+}{
+	{"kib", 1 << 10},
+	{"mib", 1 << 20},
+	{"gib", 1 << 30},
+	{"kb", 1e3},
+	{"mb", 1e6},
+	{"gb", 1e9},
+	{"k", 1e3},
+	{"m", 1e6},
+	{"g", 1e9},
+	{"b", 1},
+}
+
+// Rate is a throughput in bytes per second, zero means unlimited. In the configuration and on
+// the command line it is written as a number with an optional unit, e.g. "512KiB" or "10MB/s".
+type Rate int64
+
+func ParseRate(value string) (Rate, error) {
+	text := strings.ToLower(strings.TrimSpace(value))
+	text = strings.TrimSuffix(text, "/s")
+	if text == "" || text == "0" || text == "unlimited" {
+		return 0, nil
+	}
+	factor := 1.0
+	for _, unit := range units {
+		if strings.HasSuffix(text, unit.suffix) {
+			factor = unit.factor
+			text = strings.TrimSpace(strings.TrimSuffix(text, unit.suffix))
+			break
+		}
+	}
+	number, err := strconv.ParseFloat(text, 64)
+	if err != nil || number < 0 {
+		return 0, fmt.Errorf("invalid rate %q, expected e.g. 500KB or 10MiB", value)
+	}
+	return Rate(number * factor), nil
+}
+
+func (r Rate) String() string {
+	switch {
+	case r <= 0:
+		return "unlimited"
+	case r%(1<<20) == 0:
+		return strconv.FormatInt(int64(r>>20), 10) + "MiB"
+	case r%(1<<10) == 0:
+		return strconv.FormatInt(int64(r>>10), 10) + "KiB"
+	case r%1e6 == 0:
+		return strconv.FormatInt(int64(r/1e6), 10) + "MB"
+	case r%1e3 == 0:
+		return strconv.FormatInt(int64(r/1e3), 10) + "KB"
+	}
+	return strconv.FormatInt(int64(r), 10) + "B"
+}
+
+// Set and Type make Rate usable as a command line flag.
+func (r *Rate) Set(value string) error {
+	parsed, err := ParseRate(value)
+	if err != nil {
+		return err
+	}
+	*r = parsed
+	return nil
+}
+
+func (r *Rate) Type() string {
+	return "rate"
+}
+
+func (r *Rate) UnmarshalYAML(node *yaml.Node) error {
+	var value string
+	err := node.Decode(&value)
+	if err != nil {
+		return err
+	}
+	return r.Set(value)
+}
+
+func (r Rate) MarshalYAML() (interface{}, error) {
+	return r.String(), nil
+}
+
+// Limiter caps the throughput of the readers and writers it is applied to. A nil Limiter is unlimited.
+type Limiter struct {
+	limiter *rate.Limiter
+}
+
+// NewLimiter returns a limiter for the rate, or nil when the rate is unlimited.
+func NewLimiter(r Rate) *Limiter {
+	if r <= 0 {
+		return nil
+	}
+	burst := int(r)
+	if burst > chunkSize {
+		burst = chunkSize
+	}
+	return &Limiter{limiter: rate.NewLimiter(rate.Limit(r), burst)}
+}
+
+// chunk returns how much data may be passed through at once.
+func (l *Limiter) chunk() int {
+	if l == nil {
+		return chunkSize
+	}
+	return l.limiter.Burst()
+}
+
+func (l *Limiter) wait(ctx context.Context, n int) error {
+	if l == nil {
+		return nil
+	}
+	return l.limiter.WaitN(ctx, n)
+}
+
+// waitAll blocks until every limiter allows n bytes.
+func waitAll(ctx context.Context, limiters []*Limiter, n int) error {
+	for _, limiter := range limiters {
+		err := limiter.wait(ctx, n)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// chunkFor returns the largest amount of data all limiters accept at once.
+func chunkFor(limiters []*Limiter) int {
+	size := chunkSize
+	for _, limiter := range limiters {
+		size = min(size, limiter.chunk())
+	}
+	return size
+}
+
+func active(limiters []*Limiter) []*Limiter {
+	var result []*Limiter
+	for _, limiter := range limiters {
+		if limiter != nil {
+			result = append(result, limiter)
+		}
+	}
+	return result
+}
+
+// Wait blocks until every limiter allows n bytes, for data that is not passed through a Reader or Writer.
+func Wait(ctx context.Context, n int, limiters ...*Limiter) error {
+	limiters = active(limiters)
+	chunk := chunkFor(limiters)
+	for n > 0 && len(limiters) > 0 {
+		size := min(n, chunk)
+		err := waitAll(ctx, limiters, size)
+		if err != nil {
+			return err
+		}
+		n -= size
+	}
+	return nil
+}
+
+type writer struct {
+	ctx      context.Context
+	w        io.Writer
+	limiters []*Limiter
+	chunk    int
+}
+
+// Writer returns a writer passing data to w no faster than every limiter allows.
+func Writer(ctx context.Context, w io.Writer, limiters ...*Limiter) io.Writer {
+	limiters = active(limiters)
+	if len(limiters) == 0 {
+		return w
+	}
+	return &writer{ctx: ctx, w: w, limiters: limiters, chunk: chunkFor(limiters)}
+}
+
+func (w *writer) Write(b []byte) (int, error) {
+	written := 0
+	for len(b) > 0 {
+		n := min(len(b), w.chunk)
+		err := waitAll(w.ctx, w.limiters, n)
+		if err != nil {
+			return written, err
+		}
+		n, err = w.w.Write(b[:n])
+		written += n
+		if err != nil {
+			return written, err
+		}
+		b = b[n:]
+	}
+	return written, nil
+}
+
+type reader struct {
+	ctx      context.Context
+	r        io.Reader
+	limiters []*Limiter
+	chunk    int
+}
+
+// Reader returns a reader receiving data from r no faster than every limiter allows.
+func Reader(ctx context.Context, r io.Reader, limiters ...*Limiter) io.Reader {
+	limiters = active(limiters)
+	if len(limiters) == 0 {
+		return r
+	}
+	return &reader{ctx: ctx, r: r, limiters: limiters, chunk: chunkFor(limiters)}
+}
+
+func (r *reader) Read(b []byte) (int, error) {
+	if len(b) > r.chunk {
+		b = b[:r.chunk]
+	}
+	n, err := r.r.Read(b)
+	if n > 0 {
+		waitErr := waitAll(r.ctx, r.limiters, n)
+		if waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
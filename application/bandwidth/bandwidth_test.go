@@ -0,0 +1,56 @@
+package bandwidth
+
+import "testing"
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    Rate
+		wantErr bool
+	}{
+		{"", 0, false},
+		{"0", 0, false},
+		{"unlimited", 0, false},
+		{"Unlimited", 0, false},
+		{"512", 512, false},
+		{"512B", 512, false},
+		{"512KiB", 512 << 10, false},
+		{"10MiB/s", 10 << 20, false},
+		{"1GiB", 1 << 30, false},
+		{"500KB", 500e3, false},
+		{"10MB/s", 10e6, false},
+		{"2gb", 2e9, false},
+		{"1.5M", 1.5e6, false},
+		{"100k", 100e3, false},
+		{" 64 KiB ", 64 << 10, false},
+		{"fast", 0, true},
+		{"-1MB", 0, true},
+		{"10TB", 0, true},
+		{"MB", 0, true},
+	}
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			got, err := ParseRate(test.value)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("ParseRate(%q) error = %v, want error %v", test.value, err, test.wantErr)
+			}
+			if got != test.want {
+				t.Errorf("ParseRate(%q) = %d, want %d", test.value, got, test.want)
+			}
+		})
+	}
+}
+
+func TestRateStringParses(t *testing.T) {
+	for _, rate := range []Rate{0, 1, 999, 1000, 1024, 1500, 1 << 20, 3e6, 5 << 30} {
+		t.Run(rate.String(), func(t *testing.T) {
+			got, err := ParseRate(rate.String())
+			if err != nil {
+				t.Fatalf("ParseRate(%q): %v", rate.String(), err)
+			}
+			if got != rate {
+				t.Errorf("ParseRate(%q) = %d, want %d", rate.String(), got, rate)
+			}
+		})
+	}
+}
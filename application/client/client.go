@@ -1,23 +1,50 @@
 package client
 
 import (
+	"context"
 	"crypto"
 	cryptoRand "crypto/rand"
 	"crypto/rsa"
 	"crypto/sha256"
 	"errors"
 	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"lazysync/application/bandwidth"
 	manager "lazysync/application/service"
 	"lazysync/application/web"
 	"lazysync/modules"
+	_ "lazysync/modules/builtin" // Registers the built-in modules.
+	"lazysync/modules/plugin"
+	"log/slog"
+	"net/http"
 	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 )
 
 const Type = "client"
 
+// DefaultWorkers is the amount of files downloaded in parallel by a module.
+const DefaultWorkers = 4
+
 type Client struct {
 	Configuration *manager.AppConfiguration
 	JWTToken      string
+	Modules       []string // Modules to synchronize, all enabled ones when empty.
+	Daemon        bool
+	Interval      time.Duration
+	Workers       int            // Parallel downloads per module.
+	MaxRate       bandwidth.Rate // Download rate shared by all transfers, zero for unlimited.
+	limiter       *bandwidth.Limiter
+	sessionLock   sync.RWMutex
+	server        *manager.HelloResponse // Handshake result, nil until the next handshake.
+	remote        transport
+	PrivateKey    *rsa.PrivateKey        // Key signing logins, read from the key directory when nil.
+	Directory     string                 // Where modules write local files, the working directory when empty.
+	Progress      func(manager.Progress) // Called with the progress of every synchronization, may be nil.
+	Logger        *slog.Logger
 }
 
 func (c *Client) GetType() string {
@@ -26,7 +53,7 @@ func (c *Client) GetType() string {
 
 func (c *Client) SetMode(module modules.Module) {
 	c.Configuration.Mode = c.GetType()
-	c.Configuration.Module = module.GetId()
+	c.Configuration.EnableModule(module.GetId(), nil)
 }
 
 func (c *Client) Setup() {
@@ -39,29 +66,350 @@ func (c *Client) Setup() {
 	manager.SaveConfiguration(c.Configuration)
 }
 
+func (c *Client) SetLogger(logger *slog.Logger) {
+	c.Logger = logger
+}
+
 func (c *Client) Run() {
-	fmt.Println("Starting client...")
-	username := c.Configuration.Username
-	key := manager.ReadPrivateKey(username)
-	hashedUsername := sha256.Sum256([]byte(username))
-	signature, _ := rsa.SignPKCS1v15(cryptoRand.Reader, key, crypto.SHA256, hashedUsername[:])
-	response, err := web.Login(username, signature)
+	if c.Logger == nil {
+		c.Logger = slog.Default()
+	}
+	c.Logger.Info("Starting client...")
+	err := c.Connect()
 	if err != nil {
-		panic(err)
+		c.Logger.Error("Invalid connection settings", "error", err)
+		os.Exit(1)
+	}
+	defer c.Close()
+	if c.Daemon {
+		c.RunDaemon()
+		return
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	err = c.synchronize(ctx)
+	if err != nil {
+		c.Logger.Error("Synchronization failed", "error", err)
+		stop()
+		os.Exit(1)
+	}
+}
+
+// Connect applies the connection settings and prepares the transport to the server. Run calls it,
+// programs embedding the client call it before Login and SyncModule. Every client has its own
+// connection settings.
+func (c *Client) Connect() error {
+	if c.Logger == nil {
+		c.Logger = slog.Default()
+	}
+	c.limiter = bandwidth.NewLimiter(c.MaxRate)
+	remote, err := newTransport(c.Configuration)
+	if err != nil {
+		return err
+	}
+	c.sessionLock.Lock()
+	c.remote = remote
+	c.sessionLock.Unlock()
+	return nil
+}
+
+// Close releases the connection to the server.
+func (c *Client) Close() error {
+	remote := c.remoteTransport()
+	if remote == nil {
+		return nil
+	}
+	return remote.Close()
+}
+
+// Login performs the handshake and makes sure the client holds a valid session.
+func (c *Client) Login(ctx context.Context) error {
+	err := c.handshake(ctx)
+	if err != nil {
+		return err
+	}
+	return c.authenticate(ctx)
+}
+
+// SyncModule synchronizes a single module, signing in first when needed.
+func (c *Client) SyncModule(ctx context.Context, moduleName string) error {
+	err := c.Login(ctx)
+	if err != nil {
+		return err
+	}
+	moduleInstance, err := c.moduleHandler()
+	if err != nil {
+		return err
 	}
-	c.JWTToken = response.Object
-	moduleName := c.Configuration.Module
+	return c.synchronizeModule(ctx, moduleInstance, moduleName)
+}
+
+// moduleHandler returns new instances of the built-in modules and of the configured plugins.
+func (c *Client) moduleHandler() (*modules.ModuleHandler, error) {
 	moduleInstance := modules.InitModuleHandler()
+	err := plugin.Load(moduleInstance, c.Configuration.Plugins)
+	if err != nil {
+		return nil, err
+	}
+	return moduleInstance, nil
+}
+
+// synchronize performs a single sync round: it makes sure the client holds a valid session,
+// then requests the state of every selected module from the server and applies it locally.
+// A failing module does not prevent the remaining ones from being synchronized.
+func (c *Client) synchronize(ctx context.Context) error {
+	err := c.Login(ctx)
+	if err != nil {
+		return err
+	}
+	moduleNames := c.selectedModules()
+	if len(moduleNames) == 0 {
+		return errors.New("no modules enabled")
+	}
+	moduleInstance, err := c.moduleHandler()
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, moduleName := range moduleNames {
+		err = c.synchronizeModule(ctx, moduleInstance, moduleName)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("module %s: %w", moduleName, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// synchronizeModule synchronizes a module, reporting when it starts and finishes.
+func (c *Client) synchronizeModule(ctx context.Context, moduleInstance *modules.ModuleHandler, moduleName string) error {
+	c.report(manager.Progress{Type: manager.ProgressModuleStarted, Module: moduleName})
+	err := c.executeModule(ctx, moduleInstance, moduleName)
+	c.report(manager.Progress{Type: manager.ProgressModuleFinished, Module: moduleName, Error: err})
+	return err
+}
+
+func (c *Client) executeModule(ctx context.Context, moduleInstance *modules.ModuleHandler, moduleName string) error {
 	module, err := moduleInstance.GetModuleByName(moduleName)
 	if err != nil {
-		panic(err)
+		return err
+	}
+	if config := c.moduleConfiguration(moduleName); config != nil {
+		config, err = modules.DecodeConfiguration(moduleName, config)
+		if err != nil {
+			return err
+		}
+		err = module.SetConfiguration(config)
+		if err != nil {
+			return fmt.Errorf("invalid configuration of module %s: %w", moduleName, err)
+		}
+	}
+	if module, ok := module.(modules.LoggingModule); ok {
+		module.SetLogger(c.Logger.With("module", moduleName))
+	}
+	if module, ok := module.(modules.RemoteModule); ok {
+		module.SetServerUrl(c.serverUrl())
+		module.SetConnection(c.remoteTransport().Connection())
+	}
+	if module, ok := module.(modules.TransferModule); ok {
+		module.SetTransferLimits(c.Workers, c.limiter)
 	}
-	expectedObject := module.GetSyncObjectInstance()
-	syncResponse, err := web.Sync(username, c.JWTToken, c.Configuration.Module, expectedObject)
+	if remote, ok := c.remoteTransport().(*grpcTransport); ok {
+		if module, ok := module.(modules.GRPCClientModule); ok {
+			module.SetGRPCConnection(remote.conn)
+		}
+	}
+	if module, ok := module.(modules.ProgressModule); ok {
+		module.SetProgress(func(progress manager.Progress) {
+			progress.Module = moduleName
+			c.report(progress)
+		})
+	}
+	if module, ok := module.(modules.DestinationModule); ok {
+		module.SetDestination(c.Directory)
+	}
+	if module, ok := module.(modules.FeatureModule); ok {
+		if capabilities, announced := c.serverInfo().ModuleCapabilities(moduleName); announced {
+			module.SetServerCapabilities(capabilities)
+		}
+	}
+	syncObject := module.GetSyncObjectInstance()
+	err = c.remoteTransport().Sync(ctx, c.Configuration.Username, c.token(), moduleName, syncObject)
+	var serviceError *manager.Error
 	if err != nil {
-		panic(err)
+		// The session may have been dropped or the server replaced, start over next time. Errors
+		// the server reports for the module itself and malformed sync objects leave the session
+		// intact, the latter are never acted on.
+		invalidObject := errors.Is(err, manager.ErrInvalidSyncObject)
+		if !invalidObject && (!errors.As(err, &serviceError) || errors.Is(err, manager.ErrUnauthorized)) {
+			c.resetSession()
+		}
+		return err
+	}
+	return module.ExecuteCommands(ctx, syncObject)
+}
+
+// moduleConfiguration returns the config section of an enabled module, nil when it has none.
+func (c *Client) moduleConfiguration(moduleName string) interface{} {
+	for _, module := range c.Configuration.EnabledModules() {
+		if module.ID == moduleName {
+			return module.Config
+		}
+	}
+	return nil
+}
+
+// selectedModules returns the modules requested for this run, or every enabled module.
+func (c *Client) selectedModules() []string {
+	if len(c.Modules) > 0 {
+		return c.Modules
+	}
+	var moduleNames []string
+	for _, module := range c.Configuration.EnabledModules() {
+		moduleNames = append(moduleNames, module.ID)
+	}
+	return moduleNames
+}
+
+// handshake asks the server for its versions and capabilities once per session and refuses to
+// continue with a server speaking an incompatible protocol.
+func (c *Client) handshake(ctx context.Context) error {
+	if c.serverInfo() != nil {
+		return nil
+	}
+	hello, err := c.remoteTransport().Hello(ctx)
+	if err != nil {
+		return fmt.Errorf("handshake failed: %w", err)
+	}
+	err = manager.CheckProtocol(hello.ProtocolVersion)
+	if err != nil {
+		return fmt.Errorf("server %s: %w", c.Configuration.GetServerUrl(), err)
+	}
+	if hello.ProtocolVersion == manager.LegacyProtocolVersion {
+		c.Logger.Warn("Server predates the protocol handshake, please update it", "server", c.Configuration.GetServerUrl())
+	} else {
+		c.Logger.Debug("Connected", "server_version", hello.ServerVersion, "protocol_version", hello.ProtocolVersion)
+	}
+	c.sessionLock.Lock()
+	c.server = hello
+	c.sessionLock.Unlock()
+	return nil
+}
+
+func (c *Client) serverInfo() *manager.HelloResponse {
+	c.sessionLock.RLock()
+	defer c.sessionLock.RUnlock()
+	return c.server
+}
+
+// resetSession forgets the token and the handshake result.
+func (c *Client) resetSession() {
+	c.sessionLock.Lock()
+	c.JWTToken = ""
+	c.server = nil
+	c.sessionLock.Unlock()
+}
+
+// authenticate reuses the current JWT while it is valid, refreshes it shortly before
+// it expires and falls back to a key based login when there is no usable token.
+func (c *Client) authenticate(ctx context.Context) error {
+	token := c.token()
+	if token != "" {
+		expiresAt, err := tokenExpiration(token)
+		if err == nil && time.Until(expiresAt) > refreshThreshold {
+			return nil
+		}
+		if err == nil && time.Until(expiresAt) > 0 {
+			response, err := c.remoteTransport().Refresh(ctx, c.Configuration.Username, token)
+			if err == nil && response.Status == http.StatusOK && response.Object != "" {
+				c.setToken(response.Object)
+				return nil
+			}
+		}
+	}
+	return c.login(ctx)
+}
+
+func (c *Client) login(ctx context.Context) error {
+	username := c.Configuration.Username
+	key, err := c.privateKey()
+	if err != nil {
+		return fmt.Errorf("cannot read the key of %s: %w", username, err)
+	}
+	hashedUsername := sha256.Sum256([]byte(username))
+	signature, err := rsa.SignPKCS1v15(cryptoRand.Reader, key, crypto.SHA256, hashedUsername[:])
+	if err != nil {
+		return err
+	}
+	response, err := c.remoteTransport().Login(ctx, username, signature)
+	if err != nil {
+		return err
+	}
+	if response.Status != http.StatusOK || response.Object == "" {
+		return errors.New("authentication failed for user " + username)
+	}
+	c.setToken(response.Object)
+	return nil
+}
+
+func (c *Client) privateKey() (*rsa.PrivateKey, error) {
+	if c.PrivateKey != nil {
+		return c.PrivateKey, nil
+	}
+	return manager.LoadPrivateKey(manager.KeyBasePath + c.Configuration.Username + "/key.rsa")
+}
+
+// report passes a progress event to the Progress callback, if set.
+func (c *Client) report(progress manager.Progress) {
+	if c.Progress != nil {
+		c.Progress(progress)
+	}
+}
+
+// remoteTransport returns the transport to the configured server.
+func (c *Client) remoteTransport() transport {
+	c.sessionLock.RLock()
+	defer c.sessionLock.RUnlock()
+	return c.remote
+}
+
+func (c *Client) token() string {
+	c.sessionLock.RLock()
+	defer c.sessionLock.RUnlock()
+	return c.JWTToken
+}
+
+func (c *Client) setToken(token string) {
+	c.sessionLock.Lock()
+	c.JWTToken = token
+	c.sessionLock.Unlock()
+}
+
+// session returns a consistent view of the server, credentials and modules used by background workers.
+func (c *Client) session() (serverUrl string, username string, moduleNames []string, token string) {
+	c.sessionLock.RLock()
+	defer c.sessionLock.RUnlock()
+	return c.serverUrl(), c.Configuration.Username, c.selectedModules(), c.JWTToken
+}
+
+// serverUrl returns the base url of requests to the configured server.
+func (c *Client) serverUrl() string {
+	return web.BaseUrl(c.Configuration.GetServerUrl())
+}
+
+func tokenExpiration(token string) (time.Time, error) {
+	claims := jwt.MapClaims{}
+	_, _, err := jwt.NewParser().ParseUnverified(token, claims)
+	if err != nil {
+		return time.Time{}, err
+	}
+	expiresAt, err := claims.GetExpirationTime()
+	if err != nil {
+		return time.Time{}, err
+	}
+	if expiresAt == nil {
+		return time.Time{}, errors.New("token has no expiration time")
 	}
-	module.ExecuteCommands(*syncResponse)
+	return expiresAt.Time, nil
 }
 
 func (c *Client) ScanUsername() (string, error) {
@@ -0,0 +1,243 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	manager "lazysync/application/service"
+	"math/rand"
+	"os"
+	"os/signal"
+	"slices"
+	"syscall"
+	"time"
+)
+
+// DefaultInterval is the time between two synchronizations in daemon mode.
+const DefaultInterval = 5 * time.Minute
+
+// refreshThreshold is how long before expiration the session token gets refreshed.
+const refreshThreshold = time.Hour
+
+// jitterFactor spreads synchronizations of many clients by up to 10% of the interval.
+const jitterFactor = 0.1
+
+const minBackoff = 5 * time.Second
+
+const maxBackoff = 30 * time.Minute
+
+// RunDaemon keeps the client alive and synchronizes periodically until SIGINT or SIGTERM
+// is received. A running synchronization is always finished before the process exits, a second
+// signal aborts it.
+// SIGHUP reloads the configuration file and triggers an immediate synchronization.
+func (c *Client) RunDaemon() {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	defer signal.Stop(reload)
+
+	interval := c.Interval
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	c.Logger.Info("Running in daemon mode", "interval", interval)
+	changes := make(chan struct{}, 1)
+	go c.watchServerEvents(ctx, changes)
+	failures := 0
+	for {
+		var wait time.Duration
+		err := c.safeSynchronize(ctx)
+		if err != nil {
+			failures++
+			wait = max(backoff(failures, interval), retryAfter(err))
+			c.Logger.Error("Synchronization failed", "error", err, "retry_in", wait.Round(time.Second))
+		} else {
+			failures = 0
+			wait = withJitter(interval)
+			c.Logger.Info("Synchronization finished", "next_in", wait.Round(time.Second))
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			c.Logger.Info("Stopping client...")
+			c.logout(context.Background())
+			return
+		case <-reload:
+			timer.Stop()
+			c.reloadConfiguration()
+		case <-changes:
+			timer.Stop()
+			c.Logger.Info("Server reported changes, synchronizing...")
+		case <-timer.C:
+		}
+	}
+}
+
+// watchServerEvents keeps a subscription to the server event stream open and signals changes
+// of the synchronized module, so the daemon does not have to wait for the next interval.
+func (c *Client) watchServerEvents(ctx context.Context, changes chan<- struct{}) {
+	failures := 0
+	for ctx.Err() == nil {
+		serverUrl, username, moduleNames, token := c.session()
+		if token == "" {
+			// Wait for the first login of the synchronization loop.
+			if !sleepContext(ctx, minBackoff) {
+				return
+			}
+			continue
+		}
+		connected := time.Now()
+		err := c.remoteTransport().Connection().Subscribe(ctx, serverUrl, username, token, func(event manager.Event) {
+			if event.Type != manager.EventModuleChanged || !slices.Contains(moduleNames, event.Module) {
+				return
+			}
+			select {
+			case changes <- struct{}{}:
+			default:
+				// A synchronization is already pending.
+			}
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		if time.Since(connected) > maxBackoff {
+			failures = 0
+		}
+		failures++
+		wait := backoff(failures, minBackoff)
+		c.Logger.Warn("Event stream unavailable", "error", err, "reconnect_in", wait.Round(time.Second))
+		if !sleepContext(ctx, wait) {
+			return
+		}
+	}
+}
+
+// sleepContext waits for the given duration and reports false if ctx was cancelled meanwhile.
+func sleepContext(ctx context.Context, duration time.Duration) bool {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// safeSynchronize runs a synchronization round, turning panics of lower layers into errors
+// so a single failed round does not bring the daemon down.
+func (c *Client) safeSynchronize(ctx context.Context) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("synchronization aborted: %v", r)
+		}
+	}()
+	// The first signal stops the daemon once the round is done, only a second one cancels it.
+	round, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancel()
+	abort := make(chan os.Signal, 2)
+	signal.Notify(abort, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(abort)
+	go func() {
+		for received := 1; ; received++ {
+			select {
+			case <-round.Done():
+				return
+			case <-abort:
+			}
+			if received > 1 {
+				c.Logger.Warn("Aborting synchronization")
+				cancel()
+				return
+			}
+			c.Logger.Info("Finishing synchronization before stopping, signal again to abort")
+		}
+	}()
+	return c.synchronize(round)
+}
+
+// logout revokes the session, so the token of a stopped daemon cannot be reused.
+func (c *Client) logout(ctx context.Context) {
+	_, username, _, token := c.session()
+	if token == "" {
+		return
+	}
+	err := c.remoteTransport().Logout(ctx, username, token)
+	if err != nil {
+		c.Logger.Warn("Logout failed", "error", err)
+	}
+	c.setToken("")
+}
+
+func (c *Client) reloadConfiguration() {
+	c.Logger.Info("Reloading configuration...")
+	configuration, err := manager.ReadConfiguration()
+	if err == nil {
+		err = c.applyConfiguration(configuration)
+	}
+	if err != nil {
+		c.Logger.Error("Configuration was not reloaded", "error", err)
+	}
+}
+
+// applyConfiguration switches to configuration and a transport using its connection settings. The
+// session is dropped when the configuration names another user or server. Nothing changes when
+// the transport cannot be set up.
+func (c *Client) applyConfiguration(configuration *manager.AppConfiguration) error {
+	remote, err := newTransport(configuration)
+	if err != nil {
+		return fmt.Errorf("invalid connection settings: %w", err)
+	}
+	c.sessionLock.Lock()
+	defer c.sessionLock.Unlock()
+	if configuration.Username != c.Configuration.Username || configuration.GetServerUrl() != c.Configuration.GetServerUrl() ||
+		configuration.Connection.Transport != c.Configuration.Connection.Transport ||
+		configuration.Connection.GRPCAddress != c.Configuration.Connection.GRPCAddress ||
+		configuration.Connection.GRPCTLS != c.Configuration.Connection.GRPCTLS {
+		c.JWTToken = ""
+		c.server = nil
+	}
+	c.Configuration = configuration
+	if c.remote != nil {
+		_ = c.remote.Close()
+	}
+	c.remote = remote
+	return nil
+}
+
+// backoff returns the exponentially growing delay before the next attempt
+// after the given number of consecutive failures.
+func backoff(failures int, interval time.Duration) time.Duration {
+	limit := maxBackoff
+	if interval > limit {
+		limit = interval
+	}
+	wait := minBackoff
+	for i := 1; i < failures && wait < limit; i++ {
+		wait *= 2
+	}
+	if wait > limit {
+		wait = limit
+	}
+	return withJitter(wait)
+}
+
+// retryAfter returns the delay the server asked for when it throttled the client.
+func retryAfter(err error) time.Duration {
+	var serviceError *manager.Error
+	if !errors.As(err, &serviceError) || serviceError.Code != manager.CodeThrottled {
+		return 0
+	}
+	seconds, _ := serviceError.Data["retry_after"].(float64)
+	return time.Duration(seconds) * time.Second
+}
+
+func withJitter(interval time.Duration) time.Duration {
+	spread := int64(float64(interval) * jitterFactor)
+	if spread <= 0 {
+		return interval
+	}
+	return interval - time.Duration(spread) + time.Duration(rand.Int63n(2*spread+1))
+}
@@ -0,0 +1,117 @@
+package client
+
+import (
+	"io"
+	manager "lazysync/application/service"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+)
+
+func newTestClient(t *testing.T) *Client {
+	t.Helper()
+	c := &Client{
+		Configuration: &manager.AppConfiguration{Mode: Type, Username: "alice", ServerUrl: "http://sync.example:8080"},
+		JWTToken:      "token",
+		Logger:        slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+	err := c.applyConfiguration(c.Configuration)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = c.remote.Close()
+	})
+	return c
+}
+
+func TestApplyConfiguration(t *testing.T) {
+	tests := []struct {
+		name      string
+		change    func(configuration *manager.AppConfiguration)
+		wantErr   bool
+		wantToken string
+	}{
+		{"same server", func(configuration *manager.AppConfiguration) {
+			configuration.Connection.Timeout = time.Minute
+		}, false, "token"},
+		{"other server", func(configuration *manager.AppConfiguration) {
+			configuration.ServerUrl = "http://other.example:8080"
+		}, false, ""},
+		{"other user", func(configuration *manager.AppConfiguration) {
+			configuration.Username = "bob"
+		}, false, ""},
+		{"invalid transport", func(configuration *manager.AppConfiguration) {
+			configuration.Connection.Transport = "carrier-pigeon"
+		}, true, "token"},
+		{"invalid proxy", func(configuration *manager.AppConfiguration) {
+			configuration.ServerUrl = "http://other.example:8080"
+			configuration.Connection.Proxy = "://"
+		}, true, "token"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := newTestClient(t)
+			previous, previousRemote := c.Configuration, c.remote
+			configuration := *previous
+			test.change(&configuration)
+			err := c.applyConfiguration(&configuration)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("applyConfiguration error = %v, want error %v", err, test.wantErr)
+			}
+			if c.JWTToken != test.wantToken {
+				t.Errorf("token = %q, want %q", c.JWTToken, test.wantToken)
+			}
+			if test.wantErr {
+				if c.Configuration != previous || c.remote != previousRemote {
+					t.Error("failed reload replaced the configuration or the transport")
+				}
+				return
+			}
+			if c.Configuration != &configuration || c.remote == previousRemote {
+				t.Error("configuration and transport were not replaced")
+			}
+		})
+	}
+}
+
+func TestReloadConfiguration(t *testing.T) {
+	directory, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Chdir(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = os.Chdir(directory)
+	})
+	c := newTestClient(t)
+	previous := c.Configuration
+
+	// A missing file keeps the running configuration.
+	c.reloadConfiguration()
+	if c.Configuration != previous || c.JWTToken != "token" {
+		t.Fatalf("reload without configuration file changed the configuration to %+v", c.Configuration)
+	}
+
+	err = os.WriteFile(manager.ConfigFile, []byte("mode: client\nusername: alice\nserver_url: http://sync.example:8080\ncolour: red\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.reloadConfiguration()
+	if c.Configuration != previous {
+		t.Fatal("reload of an invalid configuration file changed the configuration")
+	}
+
+	err = os.WriteFile(manager.ConfigFile, []byte("mode: client\nusername: bob\nserver_url: http://sync.example:8080\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.reloadConfiguration()
+	if c.Configuration.Username != "bob" || c.JWTToken != "" {
+		t.Errorf("reload resulted in user %q with token %q, want bob without token", c.Configuration.Username, c.JWTToken)
+	}
+}
@@ -0,0 +1,148 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"google.golang.org/grpc"
+	"lazysync/application/grpcapi"
+	manager "lazysync/application/service"
+	"lazysync/application/web"
+	"net/http"
+)
+
+// transport carries the calls of the client to the server, over JSON-RPC or gRPC.
+type transport interface {
+	Hello(ctx context.Context) (*manager.HelloResponse, error)
+	Login(ctx context.Context, username string, signature []byte) (*manager.AuthenticationResponse, error)
+	Refresh(ctx context.Context, username string, token string) (*manager.AuthenticationResponse, error)
+	Logout(ctx context.Context, username string, token string) error
+	Sync(ctx context.Context, username string, token string, module string, object manager.SyncObject) error
+	// Connection returns the HTTP connection of the transport, also used for event streams and by
+	// modules contacting the server on their own.
+	Connection() *web.Connection
+	Close() error
+}
+
+// newTransport returns the transport selected by the connection settings of the configuration.
+func newTransport(configuration *manager.AppConfiguration) (transport, error) {
+	connection, err := web.NewConnection(configuration.Connection)
+	if err != nil {
+		return nil, err
+	}
+	settings := connection.Settings()
+	switch settings.Transport {
+	case manager.TransportJSONRPC:
+		return jsonRPCTransport{serverUrl: web.BaseUrl(configuration.GetServerUrl()), connection: connection}, nil
+	case manager.TransportGRPC:
+		conn, err := grpcapi.Connect(settings.GRPCAddress, settings)
+		if err != nil {
+			return nil, err
+		}
+		return &grpcTransport{conn: conn, client: grpcapi.NewServerClient(conn), connection: connection}, nil
+	}
+	return nil, fmt.Errorf("unknown transport %q, expected %s or %s", settings.Transport, manager.TransportJSONRPC, manager.TransportGRPC)
+}
+
+type jsonRPCTransport struct {
+	serverUrl  string
+	connection *web.Connection
+}
+
+func (t jsonRPCTransport) Hello(ctx context.Context) (*manager.HelloResponse, error) {
+	return t.connection.Hello(ctx, t.serverUrl)
+}
+
+func (t jsonRPCTransport) Login(ctx context.Context, username string, signature []byte) (*manager.AuthenticationResponse, error) {
+	return t.connection.Login(ctx, t.serverUrl, username, signature)
+}
+
+func (t jsonRPCTransport) Refresh(ctx context.Context, username string, token string) (*manager.AuthenticationResponse, error) {
+	return t.connection.Refresh(ctx, t.serverUrl, username, token)
+}
+
+func (t jsonRPCTransport) Logout(ctx context.Context, username string, token string) error {
+	return t.connection.Logout(ctx, t.serverUrl, username, token)
+}
+
+func (t jsonRPCTransport) Sync(ctx context.Context, username string, token string, module string, object manager.SyncObject) error {
+	return t.connection.Sync(ctx, t.serverUrl, username, token, module, object)
+}
+
+func (t jsonRPCTransport) Connection() *web.Connection {
+	return t.connection
+}
+
+func (t jsonRPCTransport) Close() error {
+	t.connection.Close()
+	return nil
+}
+
+// grpcTransport calls the gRPC services of the server. Idempotent calls are retried like their
+// JSON-RPC counterparts.
+type grpcTransport struct {
+	conn       *grpc.ClientConn
+	client     *grpcapi.ServerClient
+	connection *web.Connection
+}
+
+func (t *grpcTransport) Hello(ctx context.Context) (*manager.HelloResponse, error) {
+	request := &grpcapi.HelloRequest{ProtocolVersion: manager.ProtocolVersion, ClientVersion: manager.Version}
+	var response *grpcapi.HelloResponse
+	err := t.connection.Retry(ctx, func(ctx context.Context) error {
+		var err error
+		response, err = t.client.Hello(ctx, request)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return response.HelloResponse(), nil
+}
+
+func (t *grpcTransport) Login(ctx context.Context, username string, signature []byte) (*manager.AuthenticationResponse, error) {
+	return t.authorize(ctx, &grpcapi.Token{Username: username, TokenType: manager.TokenTypeKey, Token: signature})
+}
+
+func (t *grpcTransport) Refresh(ctx context.Context, username string, token string) (*manager.AuthenticationResponse, error) {
+	return t.authorize(ctx, &grpcapi.Token{Username: username, TokenType: manager.TokenTypeJWT, Token: []byte(token)})
+}
+
+func (t *grpcTransport) authorize(ctx context.Context, token *grpcapi.Token) (*manager.AuthenticationResponse, error) {
+	response, err := t.client.Authorize(ctx, &grpcapi.AuthorizeRequest{Token: token})
+	if err != nil {
+		return nil, err
+	}
+	return &manager.AuthenticationResponse{Status: http.StatusOK, Object: response.Token}, nil
+}
+
+func (t *grpcTransport) Logout(ctx context.Context, username string, token string) error {
+	request := &grpcapi.AuthorizeRequest{Token: &grpcapi.Token{Username: username, TokenType: manager.TokenTypeJWT, Token: []byte(token)}}
+	_, err := t.client.Logout(ctx, request)
+	return err
+}
+
+func (t *grpcTransport) Sync(ctx context.Context, username string, token string, module string, object manager.SyncObject) error {
+	request := &grpcapi.SynchronizeRequest{
+		Module: module,
+		Token:  &grpcapi.Token{Username: username, TokenType: manager.TokenTypeJWT, Token: []byte(token)},
+	}
+	var response *grpcapi.SynchronizeResponse
+	err := t.connection.Retry(ctx, func(ctx context.Context) error {
+		var err error
+		response, err = t.client.Synchronize(ctx, request)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return manager.DecodeSyncObject(response.Object, object)
+}
+
+func (t *grpcTransport) Connection() *web.Connection {
+	return t.connection
+}
+
+func (t *grpcTransport) Close() error {
+	t.connection.Close()
+	return t.conn.Close()
+}
@@ -0,0 +1,199 @@
+package compression
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const Gzip = "gzip"
+
+const Zstd = "zstd"
+
+const Identity = "identity"
+
+// Supported lists the encodings understood by this build, most preferred first.
+var Supported = []string{Zstd, Gzip}
+
+// MinSize is the smallest payload worth compressing, smaller ones are sent as is.
+const MinSize = 512
+
+// ErrTooLarge is returned when decoded data exceeds the size limit given to its decoder.
+var ErrTooLarge = errors.New("decompressed data exceeds the size limit")
+
+// compressedExtensions are file types whose contents are already compressed.
+var compressedExtensions = []string{
+	".7z", ".avif", ".br", ".bz2", ".deb", ".docx", ".epub", ".flac", ".gif", ".gz", ".heic", ".jar",
+	".jpeg", ".jpg", ".lz", ".lz4", ".lzma", ".m4a", ".mkv", ".mov", ".mp3", ".mp4", ".ogg", ".png",
+	".pptx", ".rar", ".rpm", ".tgz", ".txz", ".webm", ".webp", ".whl", ".woff", ".woff2", ".xlsx",
+	".xz", ".zip", ".zst",
+}
+
+// compressedTypes are content type prefixes of already compressed data.
+var compressedTypes = []string{
+	"application/gzip", "application/x-gzip", "application/zip", "application/x-rar-compressed",
+	"application/zstd", "application/x-7z-compressed", "application/x-xz", "application/x-bzip2",
+	"audio/", "video/", "image/gif", "image/jpeg", "image/png", "image/webp", "font/woff",
+}
+
+// IsCompressed reports whether a file is already compressed, judging by its name and first bytes.
+func IsCompressed(name string, head []byte) bool {
+	extension := strings.ToLower(filepath.Ext(name))
+	if slices.Contains(compressedExtensions, extension) {
+		return true
+	}
+	contentType := mime.TypeByExtension(extension)
+	if contentType == "" && len(head) > 0 {
+		contentType = http.DetectContentType(head)
+	}
+	for _, prefix := range compressedTypes {
+		if strings.HasPrefix(contentType, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Choose returns the preferred supported encoding of the offered ones, or Identity.
+func Choose(offered []string) string {
+	for _, encoding := range Supported {
+		if slices.Contains(offered, encoding) {
+			return encoding
+		}
+	}
+	return Identity
+}
+
+// Negotiate picks the encoding for a response from an Accept-Encoding header.
+func Negotiate(acceptEncoding string) string {
+	var offered []string
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if quality, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if q, err := strconv.ParseFloat(quality, 64); err == nil && q == 0 {
+				continue
+			}
+		}
+		if name == "*" {
+			offered = append(offered, Supported...)
+			continue
+		}
+		offered = append(offered, name)
+	}
+	return Choose(offered)
+}
+
+// AcceptEncoding is the Accept-Encoding header value announcing the supported encodings.
+func AcceptEncoding() string {
+	return strings.Join(Supported, ", ")
+}
+
+// Compress encodes data, returning it unchanged with Identity when compressing would not make it smaller.
+func Compress(data []byte, encoding string) ([]byte, string, error) {
+	if encoding == Identity || encoding == "" || len(data) < MinSize {
+		return data, Identity, nil
+	}
+	var buffer bytes.Buffer
+	writer, err := NewWriter(&buffer, encoding)
+	if err != nil {
+		return nil, "", err
+	}
+	_, err = writer.Write(data)
+	if err != nil {
+		return nil, "", err
+	}
+	err = writer.Close()
+	if err != nil {
+		return nil, "", err
+	}
+	if buffer.Len() >= len(data) {
+		return data, Identity, nil
+	}
+	return buffer.Bytes(), encoding, nil
+}
+
+// Decompress decodes data compressed with the encoding, failing with ErrTooLarge when the decoded
+// data exceeds limit bytes.
+func Decompress(data []byte, encoding string, limit int64) ([]byte, error) {
+	if encoding == Identity || encoding == "" {
+		if int64(len(data)) > limit {
+			return nil, ErrTooLarge
+		}
+		return data, nil
+	}
+	reader, err := NewReader(bytes.NewReader(data), encoding, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
+
+func NewWriter(w io.Writer, encoding string) (io.WriteCloser, error) {
+	switch encoding {
+	case Gzip:
+		return gzip.NewWriter(w), nil
+	case Zstd:
+		return zstd.NewWriter(w)
+	}
+	return nil, fmt.Errorf("unsupported encoding %q", encoding)
+}
+
+// NewReader returns a reader decoding r, failing with ErrTooLarge once more than limit bytes were
+// decoded, so small payloads cannot expand into huge amounts of data.
+func NewReader(r io.Reader, encoding string, limit int64) (io.ReadCloser, error) {
+	var decoder io.ReadCloser
+	switch encoding {
+	case Gzip:
+		reader, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		decoder = reader
+	case Zstd:
+		// Windows larger than the limit are never needed, but encoders use 8 MiB ones by default.
+		window := uint64(min(max(limit, 8<<20), zstd.MaxWindowSize))
+		reader, err := zstd.NewReader(r, zstd.WithDecoderMaxWindow(window), zstd.WithDecoderMaxMemory(window))
+		if err != nil {
+			return nil, err
+		}
+		decoder = reader.IOReadCloser()
+	default:
+		return nil, fmt.Errorf("unsupported encoding %q", encoding)
+	}
+	return &limitedReader{ReadCloser: decoder, remaining: limit}, nil
+}
+
+// limitedReader fails with ErrTooLarge instead of returning more than remaining bytes.
+type limitedReader struct {
+	io.ReadCloser
+	remaining int64
+}
+
+func (r *limitedReader) Read(p []byte) (int, error) {
+	if r.remaining <= 0 {
+		// Only data beyond the limit is an error, a stream ending right at it is not.
+		var probe [1]byte
+		n, err := r.ReadCloser.Read(probe[:])
+		if n > 0 {
+			return 0, ErrTooLarge
+		}
+		return 0, err
+	}
+	if int64(len(p)) > r.remaining {
+		p = p[:r.remaining]
+	}
+	n, err := r.ReadCloser.Read(p)
+	r.remaining -= int64(n)
+	return n, err
+}
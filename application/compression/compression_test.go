@@ -0,0 +1,33 @@
+package compression
+
+import "testing"
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		want           string
+	}{
+		{"empty", "", Identity},
+		{"unsupported", "br, deflate", Identity},
+		{"gzip", "gzip", Gzip},
+		{"zstd", "zstd", Zstd},
+		{"preferred first", "gzip, zstd", Zstd},
+		{"case and spaces", "  GZIP ", Gzip},
+		{"wildcard", "*", Zstd},
+		{"quality", "gzip;q=0.5, br", Gzip},
+		{"refused", "zstd;q=0, gzip", Gzip},
+		{"refused with spaces", "zstd; q=0.0, gzip;q=1", Gzip},
+		{"all refused", "zstd;q=0, gzip;q=0", Identity},
+		{"wildcard refused", "*;q=0", Identity},
+		{"identity", "identity", Identity},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := Negotiate(test.acceptEncoding)
+			if got != test.want {
+				t.Errorf("Negotiate(%q) = %q, want %q", test.acceptEncoding, got, test.want)
+			}
+		})
+	}
+}
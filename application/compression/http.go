@@ -0,0 +1,63 @@
+package compression
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Handler decodes compressed request bodies and compresses responses with the encoding negotiated
+// from the Accept-Encoding header. Responses are buffered, so it is meant for small bodies like
+// JSON-RPC calls, not streams. Request bodies are limited to maxBodySize bytes, both as received
+// and once decoded. The supported encodings are announced in the Accept-Encoding response header,
+// so clients know they may compress their requests.
+func Handler(next http.Handler, maxBodySize int64) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Accept-Encoding", AcceptEncoding())
+		w.Header().Add("Vary", "Accept-Encoding")
+		r.Body = http.MaxBytesReader(w, r.Body, maxBodySize)
+		if encoding := strings.ToLower(r.Header.Get("Content-Encoding")); encoding != "" && encoding != Identity {
+			body, err := NewReader(r.Body, encoding, maxBodySize)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+				return
+			}
+			defer body.Close()
+			r.Body = body
+			r.Header.Del("Content-Encoding")
+			r.ContentLength = -1
+		}
+		encoding := Negotiate(r.Header.Get("Accept-Encoding"))
+		if encoding == Identity {
+			next.ServeHTTP(w, r)
+			return
+		}
+		buffered := &bufferedResponseWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(buffered, r)
+		body, encoding, err := Compress(buffered.body.Bytes(), encoding)
+		if err != nil {
+			body, encoding = buffered.body.Bytes(), Identity
+		}
+		if encoding != Identity {
+			w.Header().Set("Content-Encoding", encoding)
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.WriteHeader(buffered.status)
+		_, _ = w.Write(body)
+	})
+}
+
+type bufferedResponseWriter struct {
+	http.ResponseWriter
+	body   bytes.Buffer
+	status int
+}
+
+func (w *bufferedResponseWriter) WriteHeader(status int) {
+	w.status = status
+}
+
+func (w *bufferedResponseWriter) Write(b []byte) (int, error) {
+	return w.body.Write(b)
+}
@@ -0,0 +1,149 @@
+// Package grpcapi implements the gRPC transport of lazysync, an alternative to JSON-RPC described
+// by lazysync.proto. Messages encode themselves in the protobuf wire format, so no generated code
+// is needed and clients generated from lazysync.proto interoperate. The tests of every package
+// declaring messages check them against lazysync.proto with prototest.
+package grpcapi
+
+import (
+	"bytes"
+	"fmt"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Message is implemented by every message sent over gRPC.
+type Message interface {
+	MarshalProto() []byte
+	UnmarshalProto(data []byte) error
+}
+
+// Codec encodes Messages, it is forced on servers and clients instead of the generated code based one.
+var Codec codec
+
+type codec struct{}
+
+func (codec) Marshal(v any) ([]byte, error) {
+	message, ok := v.(Message)
+	if !ok {
+		return nil, fmt.Errorf("grpcapi: cannot marshal %T", v)
+	}
+	return message.MarshalProto(), nil
+}
+
+func (codec) Unmarshal(data []byte, v any) error {
+	message, ok := v.(Message)
+	if !ok {
+		return fmt.Errorf("grpcapi: cannot unmarshal %T", v)
+	}
+	return message.UnmarshalProto(data)
+}
+
+// Name keeps the content type of generated code, application/grpc+proto.
+func (codec) Name() string {
+	return "proto"
+}
+
+// Encoder appends fields in the protobuf wire format. Like proto3, it leaves out zero values.
+type Encoder struct {
+	buf []byte
+}
+
+func (e *Encoder) String(field protowire.Number, value string) {
+	if value == "" {
+		return
+	}
+	e.buf = protowire.AppendTag(e.buf, field, protowire.BytesType)
+	e.buf = protowire.AppendString(e.buf, value)
+}
+
+// Strings appends every value, including empty ones, as a repeated field.
+func (e *Encoder) Strings(field protowire.Number, values []string) {
+	for _, value := range values {
+		e.buf = protowire.AppendTag(e.buf, field, protowire.BytesType)
+		e.buf = protowire.AppendString(e.buf, value)
+	}
+}
+
+func (e *Encoder) Bytes(field protowire.Number, value []byte) {
+	if len(value) == 0 {
+		return
+	}
+	e.buf = protowire.AppendTag(e.buf, field, protowire.BytesType)
+	e.buf = protowire.AppendBytes(e.buf, value)
+}
+
+func (e *Encoder) Int(field protowire.Number, value int64) {
+	if value == 0 {
+		return
+	}
+	e.buf = protowire.AppendTag(e.buf, field, protowire.VarintType)
+	e.buf = protowire.AppendVarint(e.buf, uint64(value))
+}
+
+// Message appends an embedded message, nothing when it is nil.
+func (e *Encoder) Message(field protowire.Number, value Message) {
+	if value == nil {
+		return
+	}
+	e.buf = protowire.AppendTag(e.buf, field, protowire.BytesType)
+	e.buf = protowire.AppendBytes(e.buf, value.MarshalProto())
+}
+
+// Encoded returns the fields appended so far.
+func (e *Encoder) Encoded() []byte {
+	return e.buf
+}
+
+// Field is a decoded field. Value holds the contents of length delimited fields and Varint the
+// value of varint fields.
+type Field struct {
+	Number protowire.Number
+	Type   protowire.Type
+	Value  []byte
+	Varint uint64
+}
+
+func (f Field) String() string {
+	return string(f.Value)
+}
+
+// Bytes returns a copy of the contents, the decoded buffer may be reused.
+func (f Field) Bytes() []byte {
+	return bytes.Clone(f.Value)
+}
+
+func (f Field) Int() int64 {
+	return int64(f.Varint)
+}
+
+// Decode calls visit for every field of the encoded message. Fixed size fields are skipped, as
+// no message uses them, and so are fields unknown to visit, keeping messages extensible.
+func Decode(data []byte, visit func(field Field) error) error {
+	for len(data) > 0 {
+		number, wireType, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+		field := Field{Number: number, Type: wireType}
+		switch wireType {
+		case protowire.BytesType:
+			field.Value, n = protowire.ConsumeBytes(data)
+		case protowire.VarintType:
+			field.Varint, n = protowire.ConsumeVarint(data)
+		default:
+			n = protowire.ConsumeFieldValue(number, wireType, data)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+		if wireType != protowire.BytesType && wireType != protowire.VarintType {
+			continue
+		}
+		err := visit(field)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
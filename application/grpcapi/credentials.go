@@ -0,0 +1,48 @@
+package grpcapi
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"lazysync/application/service"
+	"os"
+)
+
+// ServerCredentials returns the transport credentials of a gRPC server. Without a certificate the
+// server only starts when plaintext was asked for.
+func ServerCredentials(settings service.TLSConfiguration) (credentials.TransportCredentials, error) {
+	if settings.Insecure {
+		return insecure.NewCredentials(), nil
+	}
+	if settings.CertFile == "" || settings.KeyFile == "" {
+		return nil, errors.New("grpc_tls needs a cert_file and a key_file, or insecure: true for plaintext")
+	}
+	certificate, err := tls.LoadX509KeyPair(settings.CertFile, settings.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load the gRPC certificate: %w", err)
+	}
+	return credentials.NewTLS(&tls.Config{Certificates: []tls.Certificate{certificate}, MinVersion: tls.VersionTLS12}), nil
+}
+
+// clientCredentials returns the transport credentials of a gRPC client, TLS unless plaintext was
+// asked for.
+func clientCredentials(settings service.TLSConfiguration) (credentials.TransportCredentials, error) {
+	if settings.Insecure {
+		return insecure.NewCredentials(), nil
+	}
+	config := &tls.Config{ServerName: settings.ServerName, MinVersion: tls.VersionTLS12}
+	if settings.CAFile != "" {
+		pem, err := os.ReadFile(settings.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read the gRPC CA certificates: %w", err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", settings.CAFile)
+		}
+	}
+	return credentials.NewTLS(config), nil
+}
@@ -0,0 +1,111 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
+	"google.golang.org/grpc/metadata"
+	"lazysync/application/logging"
+	"lazysync/application/service"
+	"lazysync/application/web"
+	"strings"
+	"time"
+)
+
+// MetadataRequestID is the metadata key of the request id, the counterpart of logging.HeaderRequestID.
+var MetadataRequestID = strings.ToLower(logging.HeaderRequestID)
+
+// Connect returns a client connection to the gRPC server at address, host:port or unix:///path.
+// It connects lazily, on the first call. Every unary call is bounded by the timeout of the settings,
+// streams by its idle timeout, and every call carries a request id like JSON-RPC requests do. Proxies are taken from the environment unless
+// disabled with "direct", gRPC offers no way to set an explicit one. Connections use TLS unless the
+// settings ask for plaintext.
+func Connect(address string, settings service.ConnectionConfiguration) (*grpc.ClientConn, error) {
+	settings = settings.WithDefaults()
+	if address == "" {
+		return nil, errors.New("no gRPC address configured")
+	}
+	transportCredentials, err := clientCredentials(settings.GRPCTLS)
+	if err != nil {
+		return nil, err
+	}
+	options := []grpc.DialOption{
+		grpc.WithTransportCredentials(transportCredentials),
+		grpc.WithDefaultCallOptions(grpc.ForceCodec(Codec)),
+		grpc.WithConnectParams(grpc.ConnectParams{Backoff: backoff.DefaultConfig, MinConnectTimeout: settings.ConnectTimeout}),
+		grpc.WithChainUnaryInterceptor(unaryTimeout(settings.Timeout)),
+		grpc.WithChainStreamInterceptor(streamIdleTimeout(settings.IdleTimeout)),
+	}
+	switch settings.Proxy {
+	case "":
+	case web.ProxyDirect:
+		options = append(options, grpc.WithNoProxy())
+	default:
+		return nil, errors.New("gRPC connections only support proxies set in the environment, or \"direct\"")
+	}
+	return grpc.NewClient(strings.TrimPrefix(address, "grpc://"), options...)
+}
+
+// withRequestID tags the call with a fresh id, the server logs it with every line of the call.
+func withRequestID(ctx context.Context) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, MetadataRequestID, uuid.New().String())
+}
+
+func unaryTimeout(timeout time.Duration) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, request, response any, conn *grpc.ClientConn, invoker grpc.UnaryInvoker, options ...grpc.CallOption) error {
+		ctx, cancel := context.WithTimeout(withRequestID(ctx), timeout)
+		defer cancel()
+		return invoker(ctx, method, request, response, conn, options...)
+	}
+}
+
+// streamIdleTimeout cancels a stream once opening it or receiving a message waited longer than
+// timeout, failing with web.ErrTransferStalled like file transfers over HTTP do. Streams carry
+// files of any size, so their whole duration is not bounded.
+func streamIdleTimeout(timeout time.Duration) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, conn *grpc.ClientConn, method string, streamer grpc.Streamer, options ...grpc.CallOption) (grpc.ClientStream, error) {
+		ctx, cancel := context.WithCancelCause(withRequestID(ctx))
+		timer := time.AfterFunc(timeout, func() {
+			cancel(web.ErrTransferStalled)
+		})
+		stream, err := streamer(ctx, desc, conn, method, options...)
+		timer.Stop()
+		if err != nil {
+			err = stalledError(ctx, err)
+			cancel(nil)
+			return nil, err
+		}
+		return &idleStream{ClientStream: stream, ctx: ctx, cancel: cancel, timer: timer, timeout: timeout}, nil
+	}
+}
+
+// idleStream restarts the idle timeout of a stream for every received message, time spent between
+// receiving messages does not count. The stream is released once it ended.
+type idleStream struct {
+	grpc.ClientStream
+	ctx     context.Context
+	cancel  context.CancelCauseFunc
+	timer   *time.Timer
+	timeout time.Duration
+}
+
+func (s *idleStream) RecvMsg(m any) error {
+	s.timer.Reset(s.timeout)
+	err := s.ClientStream.RecvMsg(m)
+	s.timer.Stop()
+	if err != nil {
+		err = stalledError(s.ctx, err)
+		s.cancel(nil)
+	}
+	return err
+}
+
+// stalledError reports web.ErrTransferStalled for streams cancelled by their idle timeout.
+func stalledError(ctx context.Context, err error) error {
+	if errors.Is(context.Cause(ctx), web.ErrTransferStalled) {
+		return web.ErrTransferStalled
+	}
+	return err
+}
@@ -0,0 +1,127 @@
+package grpcapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"lazysync/application/service"
+	"strconv"
+)
+
+// Trailers carrying the lazysync error code and its data as JSON, as gRPC status codes are coarser.
+const (
+	TrailerErrorCode = "lazysync-error-code"
+	TrailerErrorData = "lazysync-error-data"
+)
+
+// StatusError is a gRPC failure without a lazysync error code, e.g. an unreachable server.
+type StatusError struct {
+	Code    codes.Code
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	return "grpc: " + e.Code.String() + ": " + e.Message
+}
+
+// Retryable reports whether the call may succeed when sent again.
+func (e *StatusError) Retryable() bool {
+	return e.Code == codes.Unavailable || e.Code == codes.ResourceExhausted || e.Code == codes.Aborted
+}
+
+var statusCodes = map[int]codes.Code{
+	service.CodeParseError:           codes.InvalidArgument,
+	service.CodeInvalidRequest:       codes.InvalidArgument,
+	service.CodeMethodNotFound:       codes.Unimplemented,
+	service.CodeInvalidParams:        codes.InvalidArgument,
+	service.CodeInternalError:        codes.Internal,
+	service.CodeServerError:          codes.Internal,
+	service.CodeUnauthorized:         codes.Unauthenticated,
+	service.CodeForbidden:            codes.PermissionDenied,
+	service.CodeNotFound:             codes.NotFound,
+	service.CodeExpired:              codes.FailedPrecondition,
+	service.CodeIncompatibleProtocol: codes.FailedPrecondition,
+	service.CodeThrottled:            codes.ResourceExhausted,
+}
+
+// ToStatus turns an error returned by a handler into the trailer carrying its lazysync code and data
+// and a gRPC status. Errors without a code are reported like JSON-RPC does, as generic server errors
+// without their details, which servers log themselves.
+func ToStatus(err error) (metadata.MD, error) {
+	if err == nil {
+		return nil, nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return nil, err
+	}
+	var rpcError *service.Error
+	if !errors.As(err, &rpcError) {
+		rpcError = service.ErrServer
+	}
+	trailer := metadata.Pairs(TrailerErrorCode, strconv.Itoa(rpcError.Code))
+	if len(rpcError.Data) > 0 {
+		data, err := json.Marshal(rpcError.Data)
+		if err == nil {
+			trailer.Set(TrailerErrorData, string(data))
+		}
+	}
+	code, ok := statusCodes[rpcError.Code]
+	if !ok {
+		code = codes.Unknown
+	}
+	return trailer, status.Error(code, rpcError.Message)
+}
+
+// UnaryErrors is a server interceptor applying ToStatus to the errors of unary methods.
+func UnaryErrors(ctx context.Context, request any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	response, err := handler(ctx, request)
+	trailer, err := ToStatus(err)
+	if trailer != nil {
+		_ = grpc.SetTrailer(ctx, trailer)
+	}
+	return response, err
+}
+
+// StreamErrors is a server interceptor applying ToStatus to the errors of streaming methods.
+func StreamErrors(srv any, stream grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	trailer, err := ToStatus(handler(srv, stream))
+	if trailer != nil {
+		stream.SetTrailer(trailer)
+	}
+	return err
+}
+
+// FromStatus turns a failed call into the error the same failure produces over JSON-RPC: a
+// *service.Error when the server sent a lazysync code, context errors for cancelled and timed
+// out calls, and a *StatusError otherwise.
+func FromStatus(err error, trailer metadata.MD) error {
+	if err == nil {
+		return nil
+	}
+	failure, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+	if values := trailer.Get(TrailerErrorCode); len(values) > 0 {
+		if code, convErr := strconv.Atoi(values[0]); convErr == nil {
+			var data map[string]any
+			if values := trailer.Get(TrailerErrorData); len(values) > 0 {
+				_ = json.Unmarshal([]byte(values[0]), &data)
+			}
+			return service.NewError(code, failure.Message(), data)
+		}
+	}
+	switch failure.Code() {
+	case codes.Canceled:
+		return context.Canceled
+	case codes.DeadlineExceeded:
+		return context.DeadlineExceeded
+	case codes.Unimplemented:
+		return service.NewError(service.CodeMethodNotFound, failure.Message(), nil)
+	}
+	return &StatusError{Code: failure.Code(), Message: failure.Message()}
+}
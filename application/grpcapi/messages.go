@@ -0,0 +1,256 @@
+package grpcapi
+
+import "lazysync/application/service"
+
+type HelloRequest struct {
+	ProtocolVersion string
+	ClientVersion   string
+}
+
+type HelloResponse struct {
+	ProtocolVersion string
+	ServerVersion   string
+	Modules         []ModuleFeatures
+}
+
+type ModuleFeatures struct {
+	Name         string
+	Capabilities []string
+}
+
+type Token struct {
+	Username  string
+	TokenType string
+	Token     []byte
+}
+
+type AuthorizeRequest struct {
+	Token *Token
+}
+
+type AuthorizeResponse struct {
+	Token string
+}
+
+type LogoutResponse struct{}
+
+type SynchronizeRequest struct {
+	Module string
+	Token  *Token
+}
+
+type SynchronizeResponse struct {
+	Object []byte
+}
+
+func (m *HelloRequest) MarshalProto() []byte {
+	var e Encoder
+	e.String(1, m.ProtocolVersion)
+	e.String(2, m.ClientVersion)
+	return e.Encoded()
+}
+
+func (m *HelloRequest) UnmarshalProto(data []byte) error {
+	return Decode(data, func(field Field) error {
+		switch field.Number {
+		case 1:
+			m.ProtocolVersion = field.String()
+		case 2:
+			m.ClientVersion = field.String()
+		}
+		return nil
+	})
+}
+
+func (m *HelloResponse) MarshalProto() []byte {
+	var e Encoder
+	e.String(1, m.ProtocolVersion)
+	e.String(2, m.ServerVersion)
+	for i := range m.Modules {
+		e.Message(3, &m.Modules[i])
+	}
+	return e.Encoded()
+}
+
+func (m *HelloResponse) UnmarshalProto(data []byte) error {
+	return Decode(data, func(field Field) error {
+		switch field.Number {
+		case 1:
+			m.ProtocolVersion = field.String()
+		case 2:
+			m.ServerVersion = field.String()
+		case 3:
+			var module ModuleFeatures
+			err := module.UnmarshalProto(field.Value)
+			if err != nil {
+				return err
+			}
+			m.Modules = append(m.Modules, module)
+		}
+		return nil
+	})
+}
+
+func (m *ModuleFeatures) MarshalProto() []byte {
+	var e Encoder
+	e.String(1, m.Name)
+	e.Strings(2, m.Capabilities)
+	return e.Encoded()
+}
+
+func (m *ModuleFeatures) UnmarshalProto(data []byte) error {
+	return Decode(data, func(field Field) error {
+		switch field.Number {
+		case 1:
+			m.Name = field.String()
+		case 2:
+			m.Capabilities = append(m.Capabilities, field.String())
+		}
+		return nil
+	})
+}
+
+func (m *Token) MarshalProto() []byte {
+	var e Encoder
+	e.String(1, m.Username)
+	e.String(2, m.TokenType)
+	e.Bytes(3, m.Token)
+	return e.Encoded()
+}
+
+func (m *Token) UnmarshalProto(data []byte) error {
+	return Decode(data, func(field Field) error {
+		switch field.Number {
+		case 1:
+			m.Username = field.String()
+		case 2:
+			m.TokenType = field.String()
+		case 3:
+			m.Token = field.Bytes()
+		}
+		return nil
+	})
+}
+
+func (m *AuthorizeRequest) MarshalProto() []byte {
+	var e Encoder
+	if m.Token != nil {
+		e.Message(1, m.Token)
+	}
+	return e.Encoded()
+}
+
+func (m *AuthorizeRequest) UnmarshalProto(data []byte) error {
+	return Decode(data, func(field Field) error {
+		if field.Number == 1 {
+			m.Token = new(Token)
+			return m.Token.UnmarshalProto(field.Value)
+		}
+		return nil
+	})
+}
+
+func (m *AuthorizeResponse) MarshalProto() []byte {
+	var e Encoder
+	e.String(1, m.Token)
+	return e.Encoded()
+}
+
+func (m *AuthorizeResponse) UnmarshalProto(data []byte) error {
+	return Decode(data, func(field Field) error {
+		if field.Number == 1 {
+			m.Token = field.String()
+		}
+		return nil
+	})
+}
+
+func (m *LogoutResponse) MarshalProto() []byte {
+	return nil
+}
+
+func (m *LogoutResponse) UnmarshalProto(data []byte) error {
+	return Decode(data, func(Field) error { return nil })
+}
+
+func (m *SynchronizeRequest) MarshalProto() []byte {
+	var e Encoder
+	e.String(1, m.Module)
+	if m.Token != nil {
+		e.Message(2, m.Token)
+	}
+	return e.Encoded()
+}
+
+func (m *SynchronizeRequest) UnmarshalProto(data []byte) error {
+	return Decode(data, func(field Field) error {
+		switch field.Number {
+		case 1:
+			m.Module = field.String()
+		case 2:
+			m.Token = new(Token)
+			return m.Token.UnmarshalProto(field.Value)
+		}
+		return nil
+	})
+}
+
+func (m *SynchronizeResponse) MarshalProto() []byte {
+	var e Encoder
+	e.Bytes(2, m.Object)
+	return e.Encoded()
+}
+
+func (m *SynchronizeResponse) UnmarshalProto(data []byte) error {
+	return Decode(data, func(field Field) error {
+		switch field.Number {
+		case 2:
+			m.Object = field.Bytes()
+		}
+		return nil
+	})
+}
+
+// NewToken converts the credentials of JSON-RPC requests, nil stays nil.
+func NewToken(token *service.AuthenticationToken) *Token {
+	if token == nil {
+		return nil
+	}
+	return &Token{Username: token.Username, TokenType: token.TokenType, Token: token.Token}
+}
+
+// Credentials converts the token back, nil stays nil.
+func (m *Token) Credentials() *service.AuthenticationToken {
+	if m == nil {
+		return nil
+	}
+	return &service.AuthenticationToken{Username: m.Username, TokenType: m.TokenType, Token: m.Token}
+}
+
+// NewHelloResponse converts a handshake response, listing the modules in the given order.
+func NewHelloResponse(response *service.HelloResponse, moduleOrder []string) *HelloResponse {
+	converted := &HelloResponse{ProtocolVersion: response.ProtocolVersion, ServerVersion: response.ServerVersion}
+	for _, name := range moduleOrder {
+		if features, ok := response.Modules[name]; ok {
+			converted.Modules = append(converted.Modules, ModuleFeatures{Name: name, Capabilities: features.Capabilities})
+		}
+	}
+	return converted
+}
+
+// HelloResponse converts the handshake response back.
+func (m *HelloResponse) HelloResponse() *service.HelloResponse {
+	response := &service.HelloResponse{
+		ProtocolVersion: m.ProtocolVersion,
+		ServerVersion:   m.ServerVersion,
+		Modules:         map[string]service.ModuleFeatures{},
+	}
+	for _, module := range m.Modules {
+		capabilities := module.Capabilities
+		if capabilities == nil {
+			capabilities = []string{}
+		}
+		response.Modules[module.Name] = service.ModuleFeatures{Capabilities: capabilities}
+	}
+	return response
+}
@@ -0,0 +1,63 @@
+package grpcapi_test
+
+import (
+	"lazysync/application/grpcapi"
+	"lazysync/application/grpcapi/prototest"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+// TestMessagesMatchProto checks the hand-written messages against lazysync.proto: each message
+// has to decode into the declared message with the expected values, and decode what code
+// generated from lazysync.proto sends back into the same message.
+func TestMessagesMatchProto(t *testing.T) {
+	token := &grpcapi.Token{Username: "alice", TokenType: "jwt", Token: []byte("signed")}
+	tests := []struct {
+		name    string
+		message grpcapi.Message
+		json    string
+	}{
+		{"HelloRequest", &grpcapi.HelloRequest{ProtocolVersion: "2", ClientVersion: "1.4.0"},
+			`{"protocolVersion": "2", "clientVersion": "1.4.0"}`},
+		{"HelloRequest", &grpcapi.HelloRequest{ClientVersion: "1.4.0-rc.1+grün"},
+			`{"clientVersion": "1.4.0-rc.1+grün"}`},
+		{"HelloResponse", &grpcapi.HelloResponse{ProtocolVersion: "2", ServerVersion: "1.4.0", Modules: []grpcapi.ModuleFeatures{
+			{Name: "filesystem", Capabilities: []string{"manifest", "compression"}},
+			{Name: "updater"},
+		}}, `{"protocolVersion": "2", "serverVersion": "1.4.0", "modules": [
+			{"name": "filesystem", "capabilities": ["manifest", "compression"]},
+			{"name": "updater"}
+		]}`},
+		{"ModuleFeatures", &grpcapi.ModuleFeatures{Name: "filesystem", Capabilities: []string{"manifest"}},
+			`{"name": "filesystem", "capabilities": ["manifest"]}`},
+		{"ModuleFeatures", &grpcapi.ModuleFeatures{Capabilities: []string{"", "manifest", ""}},
+			`{"capabilities": ["", "manifest", ""]}`},
+		{"Token", token, `{"username": "alice", "tokenType": "jwt", "token": "c2lnbmVk"}`},
+		{"AuthorizeRequest", &grpcapi.AuthorizeRequest{Token: token},
+			`{"token": {"username": "alice", "tokenType": "jwt", "token": "c2lnbmVk"}}`},
+		{"AuthorizeResponse", &grpcapi.AuthorizeResponse{Token: "header.payload.signature"}, `{"token": "header.payload.signature"}`},
+		{"LogoutResponse", &grpcapi.LogoutResponse{}, `{}`},
+		{"SynchronizeRequest", &grpcapi.SynchronizeRequest{Module: "filesystem", Token: token},
+			`{"module": "filesystem", "token": {"username": "alice", "tokenType": "jwt", "token": "c2lnbmVk"}}`},
+		{"SynchronizeResponse", &grpcapi.SynchronizeResponse{Object: []byte(`{"files":[]}`)},
+			`{"object": "eyJmaWxlcyI6W119"}`},
+	}
+	file := prototest.Compile(t, "lazysync.proto", ".")
+	var tested []string
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			prototest.CheckMessage(t, file, test.name, test.message, test.json)
+		})
+		if slices.Contains(tested, test.name) {
+			continue
+		}
+		// Values equal to the defaults of proto3 are not sent.
+		t.Run(test.name+"/empty", func(t *testing.T) {
+			empty := reflect.New(reflect.TypeOf(test.message).Elem()).Interface().(grpcapi.Message)
+			prototest.CheckMessage(t, file, test.name, empty, `{}`)
+		})
+		tested = append(tested, test.name)
+	}
+	prototest.CheckService(t, file, "Server", tested)
+}
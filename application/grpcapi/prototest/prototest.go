@@ -0,0 +1,115 @@
+// Package prototest checks the hand-written gRPC messages against the proto files describing them,
+// for the tests of grpcapi and of modules serving their own gRPC services.
+package prototest
+
+import (
+	"context"
+	"github.com/bufbuild/protocompile"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"lazysync/application/grpcapi"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+// Compile parses the proto file name, found in one of the import paths.
+func Compile(t *testing.T, name string, importPaths ...string) protoreflect.FileDescriptor {
+	t.Helper()
+	compiler := protocompile.Compiler{Resolver: &protocompile.SourceResolver{ImportPaths: importPaths}}
+	files, err := compiler.Compile(context.Background(), name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files[0]
+}
+
+// unknownField is the first field number used to check that fields missing from the messages
+// are skipped, far above the ones of the proto files.
+const unknownField = 1000
+
+// CheckMessage fails the test unless message encodes to the message called name in file holding
+// the values of expected, given in protobuf JSON, and decodes the encoding of code generated from
+// file back into the same values, also when it carries fields the message does not know.
+func CheckMessage(t *testing.T, file protoreflect.FileDescriptor, name string, message grpcapi.Message, expected string) {
+	t.Helper()
+	descriptor := file.Messages().ByName(protoreflect.Name(name))
+	if descriptor == nil {
+		t.Fatalf("%s is not declared in %s", name, file.Path())
+	}
+	want := dynamicpb.NewMessage(descriptor)
+	err := protojson.Unmarshal([]byte(expected), want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := dynamicpb.NewMessage(descriptor)
+	err = proto.Unmarshal(message.MarshalProto(), got)
+	if err != nil {
+		t.Fatalf("MarshalProto() does not decode as %s: %v", name, err)
+	}
+	// Fields missing from the proto file end up among the unknown fields, which proto.Equal compares.
+	if !proto.Equal(got, want) {
+		t.Errorf("MarshalProto() decodes to %v, want %v", got, want)
+	}
+	data, err := proto.Marshal(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := reflect.New(reflect.TypeOf(message).Elem()).Interface().(grpcapi.Message)
+	err = decoded.UnmarshalProto(data)
+	if err != nil {
+		t.Fatalf("UnmarshalProto() of %s: %v", name, err)
+	}
+	if !reflect.DeepEqual(decoded, message) {
+		t.Errorf("UnmarshalProto() = %+v, want %+v", decoded, message)
+	}
+	// Fields added to later versions of the proto file, of any wire type, are skipped.
+	data = protowire.AppendVarint(protowire.AppendTag(data, unknownField, protowire.VarintType), 1)
+	data = protowire.AppendFixed32(protowire.AppendTag(data, unknownField+1, protowire.Fixed32Type), 2)
+	data = protowire.AppendFixed64(protowire.AppendTag(data, unknownField+2, protowire.Fixed64Type), 3)
+	data = protowire.AppendString(protowire.AppendTag(data, unknownField+3, protowire.BytesType), "unknown")
+	decoded = reflect.New(reflect.TypeOf(message).Elem()).Interface().(grpcapi.Message)
+	err = decoded.UnmarshalProto(data)
+	if err != nil {
+		t.Fatalf("UnmarshalProto() of %s with unknown fields: %v", name, err)
+	}
+	if !reflect.DeepEqual(decoded, message) {
+		t.Errorf("UnmarshalProto() with unknown fields = %+v, want %+v", decoded, message)
+	}
+}
+
+// CheckService fails the test unless every message the service called name in file sends or
+// receives, directly or in their fields, is among tested.
+func CheckService(t *testing.T, file protoreflect.FileDescriptor, name string, tested []string) {
+	t.Helper()
+	service := file.Services().ByName(protoreflect.Name(name))
+	if service == nil {
+		t.Fatalf("%s is not declared in %s", name, file.Path())
+	}
+	seen := map[protoreflect.FullName]bool{}
+	var check func(message protoreflect.MessageDescriptor)
+	check = func(message protoreflect.MessageDescriptor) {
+		t.Helper()
+		if seen[message.FullName()] {
+			return
+		}
+		seen[message.FullName()] = true
+		if !slices.Contains(tested, string(message.Name())) {
+			t.Errorf("%s of service %s is not tested", message.Name(), name)
+		}
+		fields := message.Fields()
+		for i := 0; i < fields.Len(); i++ {
+			if field := fields.Get(i).Message(); field != nil {
+				check(field)
+			}
+		}
+	}
+	methods := service.Methods()
+	for i := 0; i < methods.Len(); i++ {
+		check(methods.Get(i).Input())
+		check(methods.Get(i).Output())
+	}
+}
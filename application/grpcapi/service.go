@@ -0,0 +1,111 @@
+package grpcapi
+
+import (
+	"context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"strings"
+)
+
+const ServerServiceName = "lazysync.v1.Server"
+
+// ServerService is the gRPC counterpart of the JSON-RPC Server service.
+type ServerService interface {
+	Hello(ctx context.Context, request *HelloRequest) (*HelloResponse, error)
+	Authorize(ctx context.Context, request *AuthorizeRequest) (*AuthorizeResponse, error)
+	Logout(ctx context.Context, request *AuthorizeRequest) (*LogoutResponse, error)
+	Synchronize(ctx context.Context, request *SynchronizeRequest) (*SynchronizeResponse, error)
+}
+
+var serverServiceDesc = grpc.ServiceDesc{
+	ServiceName: ServerServiceName,
+	HandlerType: (*ServerService)(nil),
+	Methods: []grpc.MethodDesc{
+		UnaryMethod(ServerServiceName, "Hello", ServerService.Hello),
+		UnaryMethod(ServerServiceName, "Authorize", ServerService.Authorize),
+		UnaryMethod(ServerServiceName, "Logout", ServerService.Logout),
+		UnaryMethod(ServerServiceName, "Synchronize", ServerService.Synchronize),
+	},
+	Metadata: "lazysync.proto",
+}
+
+func RegisterServerService(registrar grpc.ServiceRegistrar, service ServerService) {
+	registrar.RegisterService(&serverServiceDesc, service)
+}
+
+// UnaryMethod describes a unary method calling handler on the registered service, which must be an S.
+func UnaryMethod[S any, Req any, Resp Message, PReq interface {
+	*Req
+	Message
+}](service string, name string, handler func(S, context.Context, PReq) (Resp, error)) grpc.MethodDesc {
+	fullMethod := "/" + service + "/" + name
+	return grpc.MethodDesc{
+		MethodName: name,
+		Handler: func(srv any, ctx context.Context, decode func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+			request := PReq(new(Req))
+			err := decode(request)
+			if err != nil {
+				return nil, err
+			}
+			call := func(ctx context.Context, request any) (any, error) {
+				return handler(srv.(S), ctx, request.(PReq))
+			}
+			if interceptor == nil {
+				return call(ctx, request)
+			}
+			return interceptor(ctx, request, &grpc.UnaryServerInfo{Server: srv, FullMethod: fullMethod}, call)
+		},
+	}
+}
+
+// MethodName turns a full gRPC method name into the JSON-RPC one, "/lazysync.v1.Server/Hello"
+// becomes "Server.Hello", so both transports share metric labels and log fields.
+func MethodName(fullMethod string) string {
+	service, method, _ := strings.Cut(strings.TrimPrefix(fullMethod, "/"), "/")
+	return service[strings.LastIndex(service, ".")+1:] + "." + method
+}
+
+// RemoteAddr returns the address a call came from, the counterpart of http.Request.RemoteAddr.
+func RemoteAddr(ctx context.Context) string {
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		return p.Addr.String()
+	}
+	return ""
+}
+
+// ServerClient calls the Server service.
+type ServerClient struct {
+	conn grpc.ClientConnInterface
+}
+
+func NewServerClient(conn grpc.ClientConnInterface) *ServerClient {
+	return &ServerClient{conn: conn}
+}
+
+func (c *ServerClient) Hello(ctx context.Context, request *HelloRequest) (*HelloResponse, error) {
+	response := new(HelloResponse)
+	return response, Invoke(ctx, c.conn, "/"+ServerServiceName+"/Hello", request, response)
+}
+
+func (c *ServerClient) Authorize(ctx context.Context, request *AuthorizeRequest) (*AuthorizeResponse, error) {
+	response := new(AuthorizeResponse)
+	return response, Invoke(ctx, c.conn, "/"+ServerServiceName+"/Authorize", request, response)
+}
+
+func (c *ServerClient) Logout(ctx context.Context, request *AuthorizeRequest) (*LogoutResponse, error) {
+	response := new(LogoutResponse)
+	return response, Invoke(ctx, c.conn, "/"+ServerServiceName+"/Logout", request, response)
+}
+
+func (c *ServerClient) Synchronize(ctx context.Context, request *SynchronizeRequest) (*SynchronizeResponse, error) {
+	response := new(SynchronizeResponse)
+	return response, Invoke(ctx, c.conn, "/"+ServerServiceName+"/Synchronize", request, response)
+}
+
+// Invoke calls a unary method, turning failures into the errors JSON-RPC calls return, see FromStatus.
+func Invoke(ctx context.Context, conn grpc.ClientConnInterface, method string, request Message, response Message) error {
+	var trailer metadata.MD
+	err := conn.Invoke(ctx, method, request, response, grpc.Trailer(&trailer))
+	return FromStatus(err, trailer)
+}
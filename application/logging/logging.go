@@ -0,0 +1,52 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+const FormatText = "text"
+
+const FormatJSON = "json"
+
+// HeaderRequestID carries the id correlating the log lines of a single request on client and server.
+const HeaderRequestID = "X-Request-ID"
+
+const KeyRequestID = "request_id"
+
+type contextKey struct{}
+
+// New creates a logger writing to w. Empty level and format default to info and text.
+func New(w io.Writer, level string, format string) (*slog.Logger, error) {
+	var slogLevel slog.Level
+	if level != "" {
+		err := slogLevel.UnmarshalText([]byte(level))
+		if err != nil {
+			return nil, fmt.Errorf("invalid log level %q, expected debug, info, warn or error", level)
+		}
+	}
+	options := &slog.HandlerOptions{Level: slogLevel}
+	switch strings.ToLower(format) {
+	case "", FormatText:
+		return slog.New(slog.NewTextHandler(w, options)), nil
+	case FormatJSON:
+		return slog.New(slog.NewJSONHandler(w, options)), nil
+	}
+	return nil, fmt.Errorf("invalid log format %q, expected %s or %s", format, FormatText, FormatJSON)
+}
+
+// WithLogger returns a context carrying the logger, usually one annotated with a request id.
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+// FromContext returns the logger stored in ctx, or the default logger.
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(contextKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
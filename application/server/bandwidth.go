@@ -0,0 +1,139 @@
+package server
+
+import (
+	"google.golang.org/grpc"
+	"io"
+	"lazysync/application/bandwidth"
+	"lazysync/application/grpcapi"
+	manager "lazysync/application/service"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// idleClientLifetime is how long the bandwidth state of a client without transfers is kept.
+const idleClientLifetime = 10 * time.Minute
+
+type clientBandwidth struct {
+	limiter   *bandwidth.Limiter
+	transfers int
+	lastSeen  time.Time
+}
+
+// BandwidthLimiter caps the throughput of module transfers, shared by all clients and per client address.
+type BandwidthLimiter struct {
+	lock      sync.Mutex
+	global    *bandwidth.Limiter
+	perClient bandwidth.Rate
+	clients   map[string]*clientBandwidth
+	lastPrune time.Time
+}
+
+func NewBandwidthLimiter(limits manager.BandwidthLimits) *BandwidthLimiter {
+	return &BandwidthLimiter{
+		global:    bandwidth.NewLimiter(limits.Global),
+		perClient: limits.PerClient,
+		clients:   map[string]*clientBandwidth{},
+		lastPrune: time.Now(),
+	}
+}
+
+// Limit throttles the responses written by the handler.
+func (l *BandwidthLimiter) Limit(next http.Handler) http.Handler {
+	if l.global == nil && l.perClient <= 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := remoteHost(r.RemoteAddr)
+		client := l.acquire(host)
+		defer l.release(host)
+		throttled := &throttledResponseWriter{
+			ResponseWriter: w,
+			writer:         bandwidth.Writer(r.Context(), w, l.global, client),
+		}
+		next.ServeHTTP(throttled, r)
+	})
+}
+
+// LimitStream throttles the data sent by streaming gRPC methods, counting the payload of
+// messages reporting its size.
+func (l *BandwidthLimiter) LimitStream(srv any, stream grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if l.global == nil && l.perClient <= 0 {
+		return handler(srv, stream)
+	}
+	host := remoteHost(grpcapi.RemoteAddr(stream.Context()))
+	client := l.acquire(host)
+	defer l.release(host)
+	return handler(srv, &throttledStream{ServerStream: stream, limiters: []*bandwidth.Limiter{l.global, client}})
+}
+
+type throttledStream struct {
+	grpc.ServerStream
+	limiters []*bandwidth.Limiter
+}
+
+func (s *throttledStream) SendMsg(m any) error {
+	if sized, ok := m.(interface{ PayloadSize() int }); ok {
+		err := bandwidth.Wait(s.Context(), sized.PayloadSize(), s.limiters...)
+		if err != nil {
+			return err
+		}
+	}
+	return s.ServerStream.SendMsg(m)
+}
+
+func (l *BandwidthLimiter) acquire(host string) *bandwidth.Limiter {
+	now := time.Now()
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.prune(now)
+	client, ok := l.clients[host]
+	if !ok {
+		client = &clientBandwidth{limiter: bandwidth.NewLimiter(l.perClient)}
+		l.clients[host] = client
+	}
+	client.transfers++
+	client.lastSeen = now
+	return client.limiter
+}
+
+func (l *BandwidthLimiter) release(host string) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if client, ok := l.clients[host]; ok {
+		client.transfers--
+		client.lastSeen = time.Now()
+	}
+}
+
+// prune forgets clients without transfers for a while.
+func (l *BandwidthLimiter) prune(now time.Time) {
+	if now.Sub(l.lastPrune) < time.Minute {
+		return
+	}
+	l.lastPrune = now
+	for host, client := range l.clients {
+		if client.transfers == 0 && now.Sub(client.lastSeen) > idleClientLifetime {
+			delete(l.clients, host)
+		}
+	}
+}
+
+type throttledResponseWriter struct {
+	http.ResponseWriter
+	writer io.Writer
+}
+
+func (w *throttledResponseWriter) Write(b []byte) (int, error) {
+	return w.writer.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the features of the underlying writer.
+func (w *throttledResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Flush sends the data written so far to the client, the throttled writer holds none back.
+func (w *throttledResponseWriter) Flush() {
+	_ = http.NewResponseController(w.ResponseWriter).Flush()
+}
@@ -0,0 +1,50 @@
+package server
+
+import (
+	"bufio"
+	manager "lazysync/application/service"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLimitKeepsResponseWriterFeatures(t *testing.T) {
+	limiter := NewBandwidthLimiter(manager.BandwidthLimits{Global: 1 << 20, PerClient: 1 << 20})
+	release := make(chan struct{})
+	handlerErrors := make(chan error, 1)
+	server := httptest.NewServer(limiter.Limit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Reaching the connection deadlines requires unwrapping the throttled writer.
+		handlerErrors <- http.NewResponseController(w).SetWriteDeadline(time.Now().Add(time.Minute))
+		_, _ = w.Write([]byte("first\n"))
+		w.(http.Flusher).Flush()
+		<-release
+		_, _ = w.Write([]byte("second\n"))
+	})))
+	defer server.Close()
+	defer close(release)
+
+	response, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	err = <-handlerErrors
+	if err != nil {
+		t.Errorf("cannot set the write deadline: %v", err)
+	}
+	// The first line only arrives before the handler finished when it was flushed.
+	lines := make(chan string, 1)
+	go func() {
+		line, _ := bufio.NewReader(response.Body).ReadString('\n')
+		lines <- line
+	}()
+	select {
+	case line := <-lines:
+		if line != "first\n" {
+			t.Errorf("received %q, want the first line", line)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the flushed line did not arrive")
+	}
+}
@@ -0,0 +1,43 @@
+package server
+
+import (
+	"errors"
+	"github.com/gorilla/rpc/v2/json2"
+	manager "lazysync/application/service"
+	"strings"
+	"time"
+)
+
+// rpcError turns the errors of services into JSON-RPC error objects. Errors raised by the rpc
+// package for unknown methods get the code of the specification and errors of the codec, e.g. for
+// requests failing to parse, keep theirs; these calls never reach afterCall and are only counted,
+// by Metrics.InstrumentRPC. Anything else not already carrying a code is an error of a service,
+// reported as generic server error, its details are only logged, by afterCall.
+func rpcError(err error) error {
+	var serviceError *manager.Error
+	if errors.As(err, &serviceError) {
+		return &json2.Error{Code: json2.ErrorCode(serviceError.Code), Message: serviceError.Message, Data: serviceError.Data}
+	}
+	var codecError *json2.Error
+	if errors.As(err, &codecError) {
+		return codecError
+	}
+	message := err.Error()
+	if strings.HasPrefix(message, "rpc: can't find") || strings.HasPrefix(message, "rpc: service/method request ill-formed") {
+		return &json2.Error{Code: json2.E_NO_METHOD, Message: message}
+	}
+	return &json2.Error{Code: json2.E_SERVER, Message: manager.ErrServer.Message}
+}
+
+// throttledError reports a rejected authentication attempt along with when to try again.
+func throttledError(throttled *ThrottledError) *manager.Error {
+	return manager.NewError(manager.CodeThrottled, throttled.Error(), map[string]any{
+		"reason":      throttled.Reason,
+		"scope":       throttled.Scope,
+		"retry_after": int(throttled.RetryAfter.Round(time.Second).Seconds()),
+	})
+}
+
+func unauthorized(message string) *manager.Error {
+	return manager.NewError(manager.CodeUnauthorized, message, nil)
+}
@@ -0,0 +1,133 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	manager "lazysync/application/service"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const eventsPath = "/events"
+
+const heartbeatInterval = 30 * time.Second
+
+// subscriberBuffer is the amount of events kept for a slow subscriber before new ones are dropped.
+const subscriberBuffer = 8
+
+// EventHub fans out server events to the subscribed clients. Events of a module only reach the
+// clients allowed to use it by the access rules of the configuration.
+type EventHub struct {
+	lock          sync.Mutex
+	configuration *manager.AppConfiguration
+	subscribers   map[chan manager.Event]*manager.Principal
+	closed        bool
+}
+
+func NewEventHub(configuration *manager.AppConfiguration) *EventHub {
+	return &EventHub{configuration: configuration, subscribers: map[chan manager.Event]*manager.Principal{}}
+}
+
+// Subscribe returns the channel receiving the events the principal may see.
+func (h *EventHub) Subscribe(principal *manager.Principal) chan manager.Event {
+	events := make(chan manager.Event, subscriberBuffer)
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.closed {
+		close(events)
+		return events
+	}
+	h.subscribers[events] = principal
+	return events
+}
+
+func (h *EventHub) Unsubscribe(events chan manager.Event) {
+	h.lock.Lock()
+	delete(h.subscribers, events)
+	h.lock.Unlock()
+}
+
+// Close ends every subscription, subscribed clients reconnect once the server is back.
+func (h *EventHub) Close() {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.closed = true
+	for subscriber := range h.subscribers {
+		close(subscriber)
+		delete(h.subscribers, subscriber)
+	}
+}
+
+func (h *EventHub) Publish(event manager.Event) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	for subscriber, principal := range h.subscribers {
+		if event.Module != "" && !h.configuration.CanUseModule(principal, event.Module) {
+			continue
+		}
+		select {
+		case subscriber <- event:
+		default:
+			// Subscriber is not keeping up, it will catch up on its next periodic sync.
+		}
+	}
+}
+
+// authenticatedRequest reports whether an HTTP request carries the username and a valid JWT of
+// the session of the user, sent by the client like web.Subscribe does.
+func (s *Server) authenticatedRequest(r *http.Request) bool {
+	username := r.Header.Get(manager.HeaderUsername)
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return username != "" && s.AuthorizeUserWithToken(username, token)
+}
+
+// HandleEvents streams server events to an authenticated client as Server-Sent Events.
+func (s *Server) HandleEvents(w http.ResponseWriter, r *http.Request) {
+	if !s.authenticatedRequest(r) {
+		http.Error(w, "not authorized", http.StatusUnauthorized)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	// The stream outlives any configured write timeout.
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	events := s.events.Subscribe(s.Configuration.Principal(r.Header.Get(manager.HeaderUsername)))
+	defer s.events.Unsubscribe(events)
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			_, err := fmt.Fprint(w, ": keepalive\n\n")
+			if err != nil {
+				return
+			}
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				continue
+			}
+			_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+			if err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,150 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	manager "lazysync/application/service"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// eventsConfiguration lets the group web use the module site and everyone use the module public.
+func eventsConfiguration() *manager.AppConfiguration {
+	return &manager.AppConfiguration{
+		Groups: []manager.GroupConfiguration{{Name: "web", Users: []string{"alice"}}},
+		Access: []manager.AccessRule{
+			{Module: "site", Allow: []string{"@web"}},
+			{Module: "public", Allow: []string{"*"}},
+		},
+	}
+}
+
+func TestEventHubPublish(t *testing.T) {
+	configuration := eventsConfiguration()
+	tests := []struct {
+		name          string
+		configuration *manager.AppConfiguration
+		username      string
+		want          []string // Modules of the received events, in order.
+	}{
+		{"group member", configuration, "alice", []string{"site", "public", ""}},
+		{"denied user", configuration, "bob", []string{"public", ""}},
+		{"without access rules", &manager.AppConfiguration{}, "bob", []string{"site", "public", "private", ""}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hub := NewEventHub(test.configuration)
+			events := hub.Subscribe(test.configuration.Principal(test.username))
+			for _, module := range []string{"site", "public", "private", ""} {
+				hub.Publish(manager.Event{Type: manager.EventModuleChanged, Module: module})
+			}
+			hub.Close()
+			var got []string
+			for event := range events {
+				got = append(got, event.Module)
+			}
+			if !slices.Equal(got, test.want) {
+				t.Errorf("received events of %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestEventHubDropsEventsOfSlowSubscribers(t *testing.T) {
+	hub := NewEventHub(&manager.AppConfiguration{})
+	events := hub.Subscribe(&manager.Principal{Username: "alice"})
+	for i := 0; i < subscriberBuffer*2; i++ {
+		hub.Publish(manager.Event{Type: manager.EventModuleChanged, Module: "site"})
+	}
+	hub.Unsubscribe(events)
+	if len(events) != subscriberBuffer {
+		t.Errorf("%d events buffered, want %d", len(events), subscriberBuffer)
+	}
+}
+
+func TestHandleEvents(t *testing.T) {
+	s := &Server{Configuration: eventsConfiguration(), Sessions: NewMemorySessionStore()}
+	s.events = NewEventHub(s.Configuration)
+	server := httptest.NewServer(http.HandlerFunc(s.HandleEvents))
+	defer server.Close()
+	defer s.events.Close()
+	token, err := s.createToken("bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		username string
+		token    string
+		status   int
+	}{
+		{"anonymous", "", "", http.StatusUnauthorized},
+		{"invalid token", "bob", "invalid", http.StatusUnauthorized},
+		{"token of another user", "alice", token, http.StatusUnauthorized},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+			request.Header.Set(manager.HeaderUsername, test.username)
+			request.Header.Set("Authorization", "Bearer "+test.token)
+			response, err := http.DefaultClient.Do(request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_ = response.Body.Close()
+			if response.StatusCode != test.status {
+				t.Errorf("status %d, want %d", response.StatusCode, test.status)
+			}
+		})
+	}
+
+	request, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	request.Header.Set(manager.HeaderUsername, "bob")
+	request.Header.Set("Authorization", "Bearer "+token)
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK || response.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("status %d with content type %q, want an event stream", response.StatusCode, response.Header.Get("Content-Type"))
+	}
+	// The handler subscribes once the headers are sent.
+	for deadline := time.Now().Add(5 * time.Second); subscribers(s.events) == 0; {
+		if time.Now().After(deadline) {
+			t.Fatal("the stream did not subscribe to events")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	s.events.Publish(manager.Event{Type: manager.EventModuleChanged, Module: "site"})
+	s.events.Publish(manager.Event{Type: manager.EventModuleChanged, Module: "public"})
+
+	lines := bufio.NewScanner(response.Body)
+	var received []manager.Event
+	for len(received) < 1 && lines.Scan() {
+		data, ok := strings.CutPrefix(lines.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		var event manager.Event
+		err = json.Unmarshal([]byte(data), &event)
+		if err != nil {
+			t.Fatalf("invalid event %q: %v", data, err)
+		}
+		received = append(received, event)
+	}
+	if len(received) != 1 || received[0].Module != "public" {
+		t.Errorf("received %+v, want only the change of public", received)
+	}
+}
+
+func subscribers(hub *EventHub) int {
+	hub.lock.Lock()
+	defer hub.lock.Unlock()
+	return len(hub.subscribers)
+}
@@ -0,0 +1,135 @@
+package server
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"lazysync/application/grpcapi"
+	"lazysync/application/logging"
+	manager "lazysync/application/service"
+	"time"
+)
+
+// grpcService serves the Server service over gRPC, sharing authentication and module dispatch
+// with the JSON-RPC methods.
+type grpcService struct {
+	server *Server
+}
+
+func (g grpcService) Hello(ctx context.Context, request *grpcapi.HelloRequest) (*grpcapi.HelloResponse, error) {
+	response, err := g.server.hello(ctx, &manager.HelloArgs{ProtocolVersion: request.ProtocolVersion, ClientVersion: request.ClientVersion})
+	if err != nil {
+		return nil, err
+	}
+	return grpcapi.NewHelloResponse(response, g.server.moduleOrder), nil
+}
+
+func (g grpcService) Authorize(ctx context.Context, request *grpcapi.AuthorizeRequest) (*grpcapi.AuthorizeResponse, error) {
+	token, err := g.server.authorize(ctx, grpcapi.RemoteAddr(ctx), request.Token.Credentials())
+	if err != nil {
+		return nil, err
+	}
+	return &grpcapi.AuthorizeResponse{Token: token}, nil
+}
+
+func (g grpcService) Logout(ctx context.Context, request *grpcapi.AuthorizeRequest) (*grpcapi.LogoutResponse, error) {
+	err := g.server.logout(ctx, grpcapi.RemoteAddr(ctx), request.Token.Credentials())
+	if err != nil {
+		return nil, err
+	}
+	return &grpcapi.LogoutResponse{}, nil
+}
+
+func (g grpcService) Synchronize(ctx context.Context, request *grpcapi.SynchronizeRequest) (*grpcapi.SynchronizeResponse, error) {
+	args := &manager.SynchronizationArgs{Module: request.Module, Token: request.Token.Credentials()}
+	response, err := g.server.synchronize(ctx, grpcapi.RemoteAddr(ctx), args)
+	if err != nil {
+		return nil, err
+	}
+	return &grpcapi.SynchronizeResponse{Object: response.Object}, nil
+}
+
+// newGRPCServer returns the gRPC server, module services are registered by initModules.
+func (s *Server) newGRPCServer(settings manager.TLSConfiguration) (*grpc.Server, error) {
+	transportCredentials, err := grpcapi.ServerCredentials(settings)
+	if err != nil {
+		return nil, err
+	}
+	server := grpc.NewServer(
+		grpc.Creds(transportCredentials),
+		grpc.ForceServerCodec(grpcapi.Codec),
+		// Calls are logged before their errors are turned into statuses, which drop the details.
+		grpc.ChainUnaryInterceptor(grpcapi.UnaryErrors, s.grpcUnaryCall),
+		grpc.ChainStreamInterceptor(grpcapi.StreamErrors, s.grpcStreamCall, s.bandwidth.LimitStream),
+	)
+	grpcapi.RegisterServerService(server, grpcService{server: s})
+	return server, nil
+}
+
+// grpcUnaryCall logs and measures unary calls like afterCall does for JSON-RPC.
+func (s *Server) grpcUnaryCall(ctx context.Context, request any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	ctx = s.withCallLogger(ctx)
+	start := time.Now()
+	response, err := handler(ctx, request)
+	s.observeGRPCCall(ctx, info.FullMethod, err, start)
+	return response, err
+}
+
+func (s *Server) grpcStreamCall(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx := s.withCallLogger(stream.Context())
+	start := time.Now()
+	err := handler(srv, &contextStream{ServerStream: stream, ctx: ctx})
+	s.observeGRPCCall(ctx, info.FullMethod, err, start)
+	return err
+}
+
+func (s *Server) observeGRPCCall(ctx context.Context, fullMethod string, err error, start time.Time) {
+	method := grpcapi.MethodName(fullMethod)
+	s.metrics.ObserveGRPCCall(method, err, start)
+	logger := logging.FromContext(ctx)
+	if err != nil {
+		logger.Warn("RPC call failed", "method", method, "transport", "grpc", "error", err)
+		return
+	}
+	logger.Debug("RPC call", "method", method, "transport", "grpc")
+}
+
+// withCallLogger makes a logger tagged with the request id sent by the client, or a new one,
+// available through the context, like withRequestLogger does for HTTP requests.
+func (s *Server) withCallLogger(ctx context.Context) context.Context {
+	var requestID string
+	if values := metadata.ValueFromIncomingContext(ctx, grpcapi.MetadataRequestID); len(values) > 0 {
+		requestID = values[0]
+	}
+	if requestID == "" || len(requestID) > 64 {
+		requestID = uuid.New().String()
+	}
+	return logging.WithLogger(ctx, s.Logger.With(logging.KeyRequestID, requestID))
+}
+
+// stopGRPC lets active gRPC calls finish until ctx is done, then cancels them.
+func (s *Server) stopGRPC(ctx context.Context, server *grpc.Server) {
+	stopped := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		s.Logger.Warn("Active gRPC calls did not finish in time")
+		server.Stop()
+		<-stopped
+	}
+}
+
+// contextStream replaces the context of a stream.
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
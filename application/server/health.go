@@ -0,0 +1,69 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	manager "lazysync/application/service"
+	"lazysync/modules"
+	"net/http"
+)
+
+const healthPath = "/healthz"
+
+const readinessPath = "/readyz"
+
+// HandleHealth reports that the process is up and serving requests.
+func (s *Server) HandleHealth(w http.ResponseWriter, r *http.Request) {
+	writeHealthReport(w, &manager.HealthReport{Status: manager.HealthStatusOk})
+}
+
+// HandleReadiness reports whether the server can handle synchronizations. The result of every check
+// is only reported to signed in users, as failures may reveal details of the server, e.g. paths.
+func (s *Server) HandleReadiness(w http.ResponseWriter, r *http.Request) {
+	results := map[string]error{
+		"config":  s.checkConfiguration(),
+		"keys":    s.checkKeys(),
+		"modules": s.checkModules(),
+	}
+	for name, module := range s.modules {
+		if module, ok := module.(modules.HealthCheckedModule); ok {
+			results["module:"+name] = module.CheckHealth()
+		}
+	}
+	report := manager.NewHealthReport(results)
+	if !s.authenticatedRequest(r) {
+		report.Checks = nil
+	}
+	writeHealthReport(w, report)
+}
+
+func (s *Server) checkConfiguration() error {
+	if s.Configuration == nil || s.Configuration.Mode != Type {
+		return errors.New("server configuration is not loaded")
+	}
+	return nil
+}
+
+func (s *Server) checkModules() error {
+	if s.modules == nil || len(s.modules) != len(s.Configuration.EnabledModules()) {
+		return errors.New("modules are not initialized")
+	}
+	return nil
+}
+
+// checkKeys reports the state of the key store, stores unable to check themselves are assumed healthy.
+func (s *Server) checkKeys() error {
+	if store, ok := s.Keys.(healthCheckedStore); ok {
+		return store.CheckHealth()
+	}
+	return nil
+}
+
+func writeHealthReport(w http.ResponseWriter, report *manager.HealthReport) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	if report.Status != manager.HealthStatusOk {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_ = json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestListen(t *testing.T) {
+	tests := []struct {
+		name    string
+		prepare func(t *testing.T, path string) // Leaves something at path before listening, if set.
+		address func(path string) string
+		network string // Network of the listener, empty when listening fails.
+	}{
+		{"tcp", nil, func(string) string { return "127.0.0.1:0" }, "tcp"},
+		{"socket", nil, func(path string) string { return unixScheme + path }, "unix"},
+		{"stale socket", func(t *testing.T, path string) {
+			listener, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			listener.SetUnlinkOnClose(false)
+			_ = listener.Close()
+		}, func(path string) string { return unixScheme + path }, "unix"},
+		{"socket in use", func(t *testing.T, path string) {
+			listener, err := net.Listen("unix", path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() {
+				_ = listener.Close()
+			})
+		}, func(path string) string { return unixScheme + path }, ""},
+		{"regular file", func(t *testing.T, path string) {
+			err := os.WriteFile(path, []byte("data"), 0600)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}, func(path string) string { return unixScheme + path }, ""},
+		{"missing directory", nil, func(path string) string { return unixScheme + filepath.Join(path, "missing", "lazysync.sock") }, ""},
+		{"missing path", nil, func(string) string { return unixScheme }, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "lazysync.sock")
+			if test.prepare != nil {
+				test.prepare(t, path)
+			}
+			listener, err := listen(test.address(path))
+			if test.network == "" {
+				if err == nil {
+					_ = listener.Close()
+					t.Fatal("listen succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer listener.Close()
+			if listener.Addr().Network() != test.network {
+				t.Errorf("listening on %s, want %s", listener.Addr().Network(), test.network)
+			}
+			if test.network != "unix" {
+				return
+			}
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Mode().Perm() != socketMode {
+				t.Errorf("socket mode %o, want %o", info.Mode().Perm(), socketMode)
+			}
+			connection, err := net.Dial("unix", path)
+			if err != nil {
+				t.Fatalf("cannot connect to the socket: %v", err)
+			}
+			_ = connection.Close()
+		})
+	}
+}
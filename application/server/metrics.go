@@ -0,0 +1,226 @@
+package server
+
+import (
+	"context"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/rpc/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"lazysync/application/logging"
+	"math"
+	"net/http"
+	"time"
+)
+
+const metricsPath = "/metrics"
+
+const metricsNamespace = "lazysync"
+
+type requestStartKey struct{}
+
+type rpcCallKey struct{}
+
+// rpcCall tells the JSON-RPC calls dispatched to a method, seen by afterCall, from the ones the rpc
+// package rejected before.
+type rpcCall struct {
+	dispatched bool
+}
+
+// Metrics holds the server wide collectors, modules add their own through modules.MetricsModule.
+type Metrics struct {
+	Registry                *prometheus.Registry
+	rpcCalls                *prometheus.CounterVec
+	rpcDuration             *prometheus.HistogramVec
+	authenticationFailures  *prometheus.CounterVec
+	authenticationThrottled *prometheus.CounterVec
+	lockouts                *prometheus.CounterVec
+	servedBytes             *prometheus.CounterVec
+	downloadsInFlight       *prometheus.GaugeVec
+	downloadDuration        *prometheus.HistogramVec
+}
+
+func NewMetrics(s *Server) *Metrics {
+	m := &Metrics{
+		Registry: prometheus.NewRegistry(),
+		rpcCalls: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "rpc_calls_total",
+			Help:      "RPC calls by method and status.",
+		}, []string{"method", "status"}),
+		rpcDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "rpc_duration_seconds",
+			Help:      "RPC call duration by method and status.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "status"}),
+		authenticationFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "authentication_failures_total",
+			Help:      "Rejected authentication attempts by token type.",
+		}, []string{"token_type"}),
+		authenticationThrottled: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "authentication_throttled_total",
+			Help:      "Authentication attempts rejected by rate limits or lockouts, by reason.",
+		}, []string{"reason"}),
+		lockouts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "authentication_lockouts_total",
+			Help:      "Lockouts started after repeated authentication failures, by scope.",
+		}, []string{"scope"}),
+		servedBytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "served_bytes_total",
+			Help:      "Bytes sent by module web services.",
+		}, []string{"module"}),
+		downloadsInFlight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "downloads_in_flight",
+			Help:      "Requests currently handled by module web services.",
+		}, []string{"module"}),
+		downloadDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "download_duration_seconds",
+			Help:      "Duration of requests handled by module web services.",
+			Buckets:   []float64{0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30, 60, 300},
+		}, []string{"module"}),
+	}
+	activeSessions := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "active_sessions",
+		Help:      "Users holding a session token.",
+	}, func() float64 {
+		count, err := s.Sessions.Count()
+		if err != nil {
+			return math.NaN()
+		}
+		return float64(count)
+	})
+	lockedOut := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "authentication_locked_out",
+		Help:      "Addresses and users currently locked out.",
+	}, func() float64 {
+		return float64(s.limiter.LockedOut())
+	})
+	m.Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.rpcCalls,
+		m.rpcDuration,
+		m.authenticationFailures,
+		m.authenticationThrottled,
+		m.lockouts,
+		lockedOut,
+		m.servedBytes,
+		m.downloadsInFlight,
+		m.downloadDuration,
+		activeSessions,
+	)
+	return m
+}
+
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.Registry, promhttp.HandlerOpts{Registry: m.Registry})
+}
+
+// invalidMethod labels calls that could not be dispatched.
+const invalidMethod = "invalid"
+
+// InstrumentRPC counts the JSON-RPC calls rejected before dispatch, e.g. for an unknown method or
+// a request failing to parse. The rpc package only reports dispatched calls to afterCall.
+func (m *Metrics) InstrumentRPC(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		call := &rpcCall{}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), rpcCallKey{}, call)))
+		if r.Method == http.MethodPost && !call.dispatched {
+			m.rpcCalls.WithLabelValues(invalidMethod, "error").Inc()
+		}
+	})
+}
+
+// ObserveCall records a finished RPC call, timed from the moment the request reached the router.
+func (m *Metrics) ObserveCall(info *rpc.RequestInfo) {
+	status := "ok"
+	if info.Error != nil {
+		status = "error"
+	}
+	if call, ok := info.Request.Context().Value(rpcCallKey{}).(*rpcCall); ok {
+		call.dispatched = true
+	}
+	m.rpcCalls.WithLabelValues(info.Method, status).Inc()
+	if start, ok := info.Request.Context().Value(requestStartKey{}).(time.Time); ok {
+		m.rpcDuration.WithLabelValues(info.Method, status).Observe(time.Since(start).Seconds())
+	}
+}
+
+// ObserveGRPCCall records a finished gRPC call, method is the name of its JSON-RPC counterpart.
+func (m *Metrics) ObserveGRPCCall(method string, err error, start time.Time) {
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	m.rpcCalls.WithLabelValues(method, status).Inc()
+	m.rpcDuration.WithLabelValues(method, status).Observe(time.Since(start).Seconds())
+}
+
+func (m *Metrics) AuthenticationFailed(tokenType string) {
+	m.authenticationFailures.WithLabelValues(tokenType).Inc()
+}
+
+func (m *Metrics) AuthenticationThrottled(reason string) {
+	m.authenticationThrottled.WithLabelValues(reason).Inc()
+}
+
+func (m *Metrics) LockedOut(scope string) {
+	m.lockouts.WithLabelValues(scope).Inc()
+}
+
+// InstrumentModule measures the requests served by the web services of a module.
+func (m *Metrics) InstrumentModule(module string) mux.MiddlewareFunc {
+	inFlight := m.downloadsInFlight.WithLabelValues(module)
+	duration := m.downloadDuration.WithLabelValues(module)
+	served := m.servedBytes.WithLabelValues(module)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			inFlight.Inc()
+			defer inFlight.Dec()
+			start := time.Now()
+			counter := &countingResponseWriter{ResponseWriter: w}
+			next.ServeHTTP(counter, r)
+			duration.Observe(time.Since(start).Seconds())
+			served.Add(float64(counter.written))
+		})
+	}
+}
+
+// withRequestStart stores the time the request was received, used to time RPC calls.
+func withRequestStart(ctx context.Context) context.Context {
+	return context.WithValue(ctx, requestStartKey{}, time.Now())
+}
+
+func (s *Server) afterCall(info *rpc.RequestInfo) {
+	s.metrics.ObserveCall(info)
+	logger := logging.FromContext(info.Request.Context())
+	if info.Error != nil {
+		logger.Warn("RPC call failed", "method", info.Method, "status", info.StatusCode, "error", info.Error)
+		return
+	}
+	logger.Debug("RPC call", "method", info.Method, "status", info.StatusCode)
+}
+
+type countingResponseWriter struct {
+	http.ResponseWriter
+	written int64
+}
+
+func (w *countingResponseWriter) Write(b []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(b)
+	w.written += int64(n)
+	return n, err
+}
+
+func (w *countingResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
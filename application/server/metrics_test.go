@@ -0,0 +1,82 @@
+package server
+
+import (
+	"github.com/gorilla/rpc/v2"
+	"github.com/gorilla/rpc/v2/json2"
+	"io"
+	manager "lazysync/application/service"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// callCount returns the value of the RPC call counter of method and status.
+func callCount(t *testing.T, m *Metrics, method string, status string) float64 {
+	t.Helper()
+	families, err := m.Registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range families {
+		if family.GetName() != metricsNamespace+"_rpc_calls_total" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			labels := map[string]string{}
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			if labels["method"] == method && labels["status"] == status {
+				return metric.GetCounter().GetValue()
+			}
+		}
+	}
+	return 0
+}
+
+func TestInstrumentRPC(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string // HTTP method of the request.
+		body   string
+		label  string // Method label of the counted call, empty when none is counted.
+		status string
+	}{
+		{"dispatched call", http.MethodPost, `{"jsonrpc": "2.0", "id": 1, "method": "TransferModule.Ping", "params": [{}]}`, "TransferModule.Ping", "ok"},
+		{"unknown method", http.MethodPost, `{"jsonrpc": "2.0", "id": 1, "method": "TransferModule.Pong", "params": [{}]}`, invalidMethod, "error"},
+		{"ill-formed method", http.MethodPost, `{"jsonrpc": "2.0", "id": 1, "method": "Ping", "params": [{}]}`, invalidMethod, "error"},
+		{"invalid params", http.MethodPost, `{"jsonrpc": "2.0", "id": 1, "method": "TransferModule.Ping", "params": "ping"}`, invalidMethod, "error"},
+		{"invalid json", http.MethodPost, `{"jsonrpc": `, invalidMethod, "error"},
+		{"not a call", http.MethodGet, "", "", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := &Server{Sessions: NewMemorySessionStore(), Logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+			s.limiter = NewAuthenticationLimiter(manager.AuthenticationLimits{})
+			s.metrics = NewMetrics(s)
+			rpcServer := rpc.NewServer()
+			rpcServer.RegisterCodec(json2.NewCustomCodecWithErrorMapper(rpc.DefaultEncoderSelector, rpcError), "application/json")
+			rpcServer.RegisterAfterFunc(s.afterCall)
+			err := rpcServer.RegisterService(&TransferModule{}, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			request := httptest.NewRequest(test.method, "/", strings.NewReader(test.body))
+			request.Header.Set("Content-Type", "application/json")
+			s.metrics.InstrumentRPC(rpcServer).ServeHTTP(httptest.NewRecorder(), request)
+			for _, label := range []string{"TransferModule.Ping", "TransferModule.Pong", invalidMethod} {
+				for _, status := range []string{"ok", "error"} {
+					want := 0.0
+					if label == test.label && status == test.status {
+						want = 1
+					}
+					if got := callCount(t, s.metrics, label, status); got != want {
+						t.Errorf("%s calls with status %s counted %v times, want %v", label, status, got, want)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,192 @@
+package server
+
+import (
+	"fmt"
+	"golang.org/x/time/rate"
+	manager "lazysync/application/service"
+	"net"
+	"sync"
+	"time"
+)
+
+const scopeAddress = "address"
+
+const scopeUser = "user"
+
+// idleAttemptsLifetime is how long the state of an address or user without activity is kept.
+const idleAttemptsLifetime = time.Hour
+
+// ThrottledError is returned for authentication attempts rejected before checking credentials.
+type ThrottledError struct {
+	Reason     string
+	Scope      string
+	RetryAfter time.Duration
+}
+
+func (e *ThrottledError) Error() string {
+	if e.Reason == reasonLockedOut {
+		return fmt.Sprintf("%s is locked out after repeated failures, retry in %s", e.Scope, e.RetryAfter.Round(time.Second))
+	}
+	return fmt.Sprintf("too many attempts for this %s, retry in %s", e.Scope, e.RetryAfter.Round(time.Second))
+}
+
+const reasonRateLimited = "rate_limited"
+
+const reasonLockedOut = "locked_out"
+
+type attempts struct {
+	limiter     *rate.Limiter
+	failures    int
+	lockedUntil time.Time
+	lastSeen    time.Time
+}
+
+// userAddress identifies the attempts for a user made from a single address.
+type userAddress struct {
+	address  string
+	username string
+}
+
+// AuthenticationLimiter applies per address and per user rate limits to login attempts and locks
+// out addresses and users with exponentially growing lockouts after repeated failures. Users are
+// tracked per address, so failures from one address never lock the user out on another.
+type AuthenticationLimiter struct {
+	lock      sync.Mutex
+	limits    manager.AuthenticationLimits
+	addresses map[string]*attempts
+	users     map[userAddress]*attempts
+	lastPrune time.Time
+}
+
+func NewAuthenticationLimiter(limits manager.AuthenticationLimits) *AuthenticationLimiter {
+	return &AuthenticationLimiter{
+		limits:    limits,
+		addresses: map[string]*attempts{},
+		users:     map[userAddress]*attempts{},
+		lastPrune: time.Now(),
+	}
+}
+
+// Allow checks an attempt against lockouts and rate limits, consuming one attempt of each.
+func (l *AuthenticationLimiter) Allow(remoteAddr string, username string) error {
+	now := time.Now()
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.prune(now)
+	address, user := l.states(remoteAddr, username, now)
+	if now.Before(address.lockedUntil) {
+		return &ThrottledError{Reason: reasonLockedOut, Scope: scopeAddress, RetryAfter: address.lockedUntil.Sub(now)}
+	}
+	if now.Before(user.lockedUntil) {
+		return &ThrottledError{Reason: reasonLockedOut, Scope: scopeUser, RetryAfter: user.lockedUntil.Sub(now)}
+	}
+	if reservation := address.limiter.ReserveN(now, 1); reservation.DelayFrom(now) > 0 {
+		reservation.CancelAt(now)
+		return &ThrottledError{Reason: reasonRateLimited, Scope: scopeAddress, RetryAfter: reservation.DelayFrom(now)}
+	}
+	if reservation := user.limiter.ReserveN(now, 1); reservation.DelayFrom(now) > 0 {
+		reservation.CancelAt(now)
+		return &ThrottledError{Reason: reasonRateLimited, Scope: scopeUser, RetryAfter: reservation.DelayFrom(now)}
+	}
+	return nil
+}
+
+// Failure registers a failed attempt and returns the lockouts it started, keyed by scope.
+func (l *AuthenticationLimiter) Failure(remoteAddr string, username string) map[string]time.Duration {
+	now := time.Now()
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	lockouts := map[string]time.Duration{}
+	address, user := l.states(remoteAddr, username, now)
+	scopes := map[string]*attempts{scopeAddress: address, scopeUser: user}
+	for scope, state := range scopes {
+		state.failures++
+		if state.failures < l.limits.MaxFailures {
+			continue
+		}
+		// Double once per failure past the limit, stopping at MaxLockout so it never overflows.
+		lockout := l.limits.Lockout
+		for i := l.limits.MaxFailures; i < state.failures && lockout < l.limits.MaxLockout; i++ {
+			lockout *= 2
+		}
+		lockout = min(lockout, l.limits.MaxLockout)
+		state.lockedUntil = now.Add(lockout)
+		lockouts[scope] = lockout
+	}
+	return lockouts
+}
+
+// Success clears the failures of the address and of the user at the address.
+func (l *AuthenticationLimiter) Success(remoteAddr string, username string) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if state, ok := l.addresses[remoteHost(remoteAddr)]; ok {
+		state.failures = 0
+	}
+	if state, ok := l.users[userAddress{address: remoteHost(remoteAddr), username: username}]; ok {
+		state.failures = 0
+	}
+}
+
+// LockedOut returns the amount of addresses and users currently locked out.
+func (l *AuthenticationLimiter) LockedOut() int {
+	now := time.Now()
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return lockedOut(l.addresses, now) + lockedOut(l.users, now)
+}
+
+// states returns the attempts of the address and of the user at the address.
+func (l *AuthenticationLimiter) states(remoteAddr string, username string, now time.Time) (*attempts, *attempts) {
+	host := remoteHost(remoteAddr)
+	address := get(l.addresses, host, l.limits.AddressRate, l.limits.Burst, now)
+	user := get(l.users, userAddress{address: host, username: username}, l.limits.UserRate, l.limits.Burst, now)
+	return address, user
+}
+
+func get[K comparable](states map[K]*attempts, key K, perMinute int, burst int, now time.Time) *attempts {
+	state, ok := states[key]
+	if !ok {
+		limit := rate.Limit(float64(perMinute) / time.Minute.Seconds())
+		state = &attempts{limiter: rate.NewLimiter(limit, burst)}
+		states[key] = state
+	}
+	state.lastSeen = now
+	return state
+}
+
+// prune forgets idle addresses and users, so attempts with random usernames cannot grow memory unbounded.
+func (l *AuthenticationLimiter) prune(now time.Time) {
+	if now.Sub(l.lastPrune) < time.Minute {
+		return
+	}
+	l.lastPrune = now
+	prune(l.addresses, now)
+	prune(l.users, now)
+}
+
+func prune[K comparable](states map[K]*attempts, now time.Time) {
+	for key, state := range states {
+		if now.Sub(state.lastSeen) > idleAttemptsLifetime && now.After(state.lockedUntil) {
+			delete(states, key)
+		}
+	}
+}
+
+func lockedOut[K comparable](states map[K]*attempts, now time.Time) int {
+	locked := 0
+	for _, state := range states {
+		if now.Before(state.lockedUntil) {
+			locked++
+		}
+	}
+	return locked
+}
+
+func remoteHost(remoteAddr string) string {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return remoteAddr
+	}
+	return host
+}
@@ -0,0 +1,174 @@
+package server
+
+import (
+	"errors"
+	manager "lazysync/application/service"
+	"maps"
+	"testing"
+	"time"
+)
+
+// step is an operation on the limiter: "allow" expects Allow to return throttled, "<reason> <scope>"
+// or "" when allowed, "failure" expects Failure to start lockouts, "success" calls Success and
+// "wait" lets fast rates refill.
+type step struct {
+	operation  string
+	remoteAddr string
+	username   string
+	throttled  string
+	lockouts   map[string]time.Duration
+}
+
+func TestAuthenticationLimiter(t *testing.T) {
+	lockouts := manager.AuthenticationLimits{
+		AddressRate: 6000,
+		UserRate:    6000,
+		Burst:       100,
+		MaxFailures: 2,
+		Lockout:     time.Minute,
+		MaxLockout:  3 * time.Minute,
+	}
+	both := func(lockout time.Duration) map[string]time.Duration {
+		return map[string]time.Duration{scopeAddress: lockout, scopeUser: lockout}
+	}
+	// Lockouts stay at the maximum however many failures follow.
+	manyFailures := []step{{operation: "failure", remoteAddr: "10.0.0.1:1000", username: "alice"}}
+	for lockout := time.Minute; len(manyFailures) < 100; lockout = min(2*lockout, 3*time.Minute) {
+		manyFailures = append(manyFailures, step{operation: "failure", remoteAddr: "10.0.0.1:1000", username: "alice", lockouts: both(lockout)})
+	}
+	tests := []struct {
+		name      string
+		limits    manager.AuthenticationLimits
+		steps     []step
+		lockedOut int
+	}{
+		{
+			name:   "failures below the limit",
+			limits: lockouts,
+			steps: []step{
+				{operation: "failure", remoteAddr: "10.0.0.1:1000", username: "alice"},
+				{operation: "allow", remoteAddr: "10.0.0.1:1000", username: "alice"},
+			},
+		},
+		{
+			name:   "lockout after max failures",
+			limits: lockouts,
+			steps: []step{
+				{operation: "failure", remoteAddr: "10.0.0.1:1000", username: "alice"},
+				{operation: "failure", remoteAddr: "10.0.0.1:1001", username: "alice", lockouts: both(time.Minute)},
+				{operation: "allow", remoteAddr: "10.0.0.1:1002", username: "alice", throttled: "locked_out address"},
+				{operation: "allow", remoteAddr: "10.0.0.1:1002", username: "bob", throttled: "locked_out address"},
+			},
+			lockedOut: 2,
+		},
+		{
+			name:   "lockout doubles up to the maximum",
+			limits: lockouts,
+			steps: []step{
+				{operation: "failure", remoteAddr: "10.0.0.1:1000", username: "alice"},
+				{operation: "failure", remoteAddr: "10.0.0.1:1000", username: "alice", lockouts: both(time.Minute)},
+				{operation: "failure", remoteAddr: "10.0.0.1:1000", username: "alice", lockouts: both(2 * time.Minute)},
+				{operation: "failure", remoteAddr: "10.0.0.1:1000", username: "alice", lockouts: both(3 * time.Minute)},
+				{operation: "failure", remoteAddr: "10.0.0.1:1000", username: "alice", lockouts: both(3 * time.Minute)},
+			},
+			lockedOut: 2,
+		},
+		{
+			name:      "many failures",
+			limits:    lockouts,
+			steps:     manyFailures,
+			lockedOut: 2,
+		},
+		{
+			name:   "user locked out at a single address",
+			limits: lockouts,
+			steps: []step{
+				{operation: "failure", remoteAddr: "10.0.0.1:1000", username: "alice"},
+				{operation: "failure", remoteAddr: "10.0.0.1:1000", username: "alice", lockouts: both(time.Minute)},
+				{operation: "allow", remoteAddr: "10.0.0.2:1000", username: "alice"},
+				{operation: "failure", remoteAddr: "10.0.0.2:1000", username: "alice"},
+				{operation: "allow", remoteAddr: "10.0.0.2:1000", username: "alice"},
+			},
+			lockedOut: 2,
+		},
+		{
+			name:   "address locked out by failures of several users",
+			limits: lockouts,
+			steps: []step{
+				{operation: "failure", remoteAddr: "10.0.0.1:1000", username: "alice"},
+				{operation: "failure", remoteAddr: "10.0.0.1:1000", username: "bob", lockouts: map[string]time.Duration{scopeAddress: time.Minute}},
+				{operation: "allow", remoteAddr: "10.0.0.1:1000", username: "carol", throttled: "locked_out address"},
+				{operation: "allow", remoteAddr: "10.0.0.2:1000", username: "alice"},
+			},
+			lockedOut: 1,
+		},
+		{
+			name:   "success clears failures",
+			limits: lockouts,
+			steps: []step{
+				{operation: "failure", remoteAddr: "10.0.0.1:1000", username: "alice"},
+				{operation: "success", remoteAddr: "10.0.0.1:1000", username: "alice"},
+				{operation: "failure", remoteAddr: "10.0.0.1:1000", username: "alice"},
+				{operation: "allow", remoteAddr: "10.0.0.1:1000", username: "alice"},
+			},
+		},
+		{
+			name:   "address rate",
+			limits: manager.AuthenticationLimits{AddressRate: 1, UserRate: 6000, Burst: 2, MaxFailures: 5, Lockout: time.Minute, MaxLockout: time.Hour},
+			steps: []step{
+				{operation: "allow", remoteAddr: "10.0.0.1:1000", username: "alice"},
+				{operation: "allow", remoteAddr: "10.0.0.1:1000", username: "bob"},
+				{operation: "allow", remoteAddr: "10.0.0.1:1000", username: "carol", throttled: "rate_limited address"},
+				{operation: "allow", remoteAddr: "10.0.0.2:1000", username: "carol"},
+			},
+		},
+		{
+			name:   "user rate",
+			limits: manager.AuthenticationLimits{AddressRate: 60000, UserRate: 1, Burst: 1, MaxFailures: 5, Lockout: time.Minute, MaxLockout: time.Hour},
+			steps: []step{
+				{operation: "allow", remoteAddr: "10.0.0.1:1000", username: "alice"},
+				{operation: "wait"},
+				{operation: "allow", remoteAddr: "10.0.0.1:1000", username: "bob"},
+				{operation: "wait"},
+				{operation: "allow", remoteAddr: "10.0.0.1:1000", username: "alice", throttled: "rate_limited user"},
+				{operation: "allow", remoteAddr: "10.0.0.2:1000", username: "alice"},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			limiter := NewAuthenticationLimiter(test.limits)
+			for i, step := range test.steps {
+				switch step.operation {
+				case "allow":
+					throttled := ""
+					var throttledError *ThrottledError
+					err := limiter.Allow(step.remoteAddr, step.username)
+					if errors.As(err, &throttledError) {
+						throttled = throttledError.Reason + " " + throttledError.Scope
+						if throttledError.RetryAfter <= 0 {
+							t.Errorf("step %d: RetryAfter = %s, want a positive delay", i, throttledError.RetryAfter)
+						}
+					} else if err != nil {
+						t.Fatalf("step %d: Allow: %v", i, err)
+					}
+					if throttled != step.throttled {
+						t.Errorf("step %d: Allow(%s, %s) throttled %q, want %q", i, step.remoteAddr, step.username, throttled, step.throttled)
+					}
+				case "failure":
+					lockouts := limiter.Failure(step.remoteAddr, step.username)
+					if !maps.Equal(lockouts, step.lockouts) {
+						t.Errorf("step %d: Failure(%s, %s) = %v, want %v", i, step.remoteAddr, step.username, lockouts, step.lockouts)
+					}
+				case "success":
+					limiter.Success(step.remoteAddr, step.username)
+				case "wait":
+					time.Sleep(10 * time.Millisecond)
+				}
+			}
+			if got := limiter.LockedOut(); got != test.lockedOut {
+				t.Errorf("LockedOut() = %d, want %d", got, test.lockedOut)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package server
 
 import (
+	"context"
 	"crypto"
 	cryptoRand "crypto/rand"
 	"crypto/rsa"
@@ -10,27 +11,54 @@ import (
 	"errors"
 	"fmt"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 	"github.com/gorilla/mux"
-	"github.com/gorilla/rpc"
-	jsonrpc "github.com/gorilla/rpc/json"
+	"github.com/gorilla/rpc/v2"
+	"github.com/gorilla/rpc/v2/json2"
+	"google.golang.org/grpc"
 	"io"
+	"lazysync/application/audit"
+	"lazysync/application/compression"
+	"lazysync/application/logging"
 	manager "lazysync/application/service"
 	"lazysync/modules"
-	"log"
+	_ "lazysync/modules/builtin" // Registers the built-in modules.
+	"lazysync/modules/plugin"
+	"log/slog"
 	"math/rand"
 	"net/http"
 	"os"
+	"os/signal"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 )
 
 const Type = "server"
 
-const port string = ":8080"
+// maxRequestSize bounds the bodies of JSON-RPC requests, before and after decompression.
+const maxRequestSize = 1 << 20
 
 type Server struct {
-	Configuration  *manager.AppConfiguration
-	ActiveSessions map[string][]byte
+	Configuration *manager.AppConfiguration
+	// Keys holds the public keys of the users, read from private/keys when unset.
+	Keys KeyStore
+	// Sessions holds the sessions of signed in users, kept in memory when unset.
+	Sessions SessionStore
+	// ExtraModules are offered next to the built-in modules, replacing built-in ones with the same id.
+	// Like built-in modules, they are only used once enabled in the configuration.
+	ExtraModules []modules.Module
+	modules      map[string]modules.Module
+	moduleOrder  []string
+	events       *EventHub
+	audit        *audit.Log
+	metrics      *Metrics
+	limiter      *AuthenticationLimiter
+	bandwidth    *BandwidthLimiter
+	handler      http.Handler
+	grpcServer   *grpc.Server
+	Logger       *slog.Logger
 }
 
 func (s *Server) GetType() string {
@@ -38,8 +66,7 @@ func (s *Server) GetType() string {
 }
 
 func (s *Server) SetMode(module modules.Module) {
-	s.Configuration.Module = module.GetId()
-	s.Configuration.ModuleSpecificConfig = module.GetConfigurationValues()
+	s.Configuration.EnableModule(module.GetId(), module.GetConfigurationValues())
 }
 
 func (s *Server) Setup() {
@@ -56,20 +83,20 @@ func (s *Server) Setup() {
 	s.GenerateKeys(2)
 }
 
+func (s *Server) SetLogger(logger *slog.Logger) {
+	s.Logger = logger
+}
+
 func (s *Server) Run() {
-	fmt.Println("Starting server...")
+	if s.Logger == nil {
+		s.Logger = slog.Default()
+	}
+	s.Logger.Info("Starting server...")
 	s.StartServer()
 }
 
 func (s *Server) AuthorizeUserWithKey(username string, signature []byte) bool {
-	userPubKey := manager.ReadPublicKey(username)
-	hashedUsername := sha256.Sum256([]byte(username))
-	err := rsa.VerifyPKCS1v15(userPubKey, crypto.SHA256, hashedUsername[:], signature)
-	if err != nil {
-		fmt.Println(err.Error())
-		return false
-	}
-	return true
+	return s.verifyKeySignature(username, signature) == nil
 }
 
 func (s *Server) AuthorizeUserWithToken(username string, token string) bool {
@@ -80,6 +107,15 @@ func (s *Server) AuthorizeUserWithToken(username string, token string) bool {
 	return true
 }
 
+func (s *Server) verifyKeySignature(username string, signature []byte) error {
+	userPubKey, err := s.Keys.PublicKey(username)
+	if err != nil {
+		return err
+	}
+	hashedUsername := sha256.Sum256([]byte(username))
+	return rsa.VerifyPKCS1v15(userPubKey, crypto.SHA256, hashedUsername[:], signature)
+}
+
 func (s *Server) GenerateKeys(usersAmount int) {
 	fmt.Println("Generating crypto keys...")
 	bitSize := 4096
@@ -174,12 +210,21 @@ func (s *Server) createToken(username string) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	s.ActiveSessions[username] = secret
+	err = s.Sessions.Store(username, secret)
+	if err != nil {
+		return "", err
+	}
 	return tokenString, nil
 }
 
 func (s *Server) verifyToken(username string, tokenString string) error {
-	secret := s.ActiveSessions[username]
+	secret, err := s.Sessions.Secret(username)
+	if err != nil {
+		return err
+	}
+	if secret == nil {
+		return errors.New("no active session")
+	}
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
 		return secret, nil
 	})
@@ -196,92 +241,497 @@ func (s *Server) verifyToken(username string, tokenString string) error {
 }
 
 func (s *Server) Authorize(r *http.Request, args *manager.AuthenticationArgs, reply *manager.AuthenticationResponse) error {
-	var response manager.AuthenticationResponse
-	if args.Token == nil {
-		return errors.New("no token provided")
+	token, err := s.authorize(r.Context(), r.RemoteAddr, args.Token)
+	if err != nil {
+		return err
+	}
+	*reply = manager.AuthenticationResponse{Status: http.StatusOK, Object: token}
+	return nil
+}
+
+// authorize verifies the credentials of a client connected from remoteAddr over any transport
+// and returns a new JWT.
+func (s *Server) authorize(ctx context.Context, remoteAddr string, token *manager.AuthenticationToken) (string, error) {
+	if token == nil {
+		return "", unauthorized("no token provided")
 	}
-	token := args.Token
-	authorized, err := s.performAuthentication(token)
-	if !authorized || err != nil {
-		return errors.New("not authorized")
+	logger := logging.FromContext(ctx)
+	// Throttle before reading keys and verifying signatures, which is the expensive part.
+	var throttled *ThrottledError
+	err := s.limiter.Allow(remoteAddr, token.Username)
+	if errors.As(err, &throttled) {
+		logger.Warn("Authentication throttled", "user", token.Username, "address", remoteAddr, "reason", throttled.Reason, "scope", throttled.Scope)
+		s.metrics.AuthenticationThrottled(throttled.Reason)
+		s.record(ctx, remoteAddr, audit.Event{Type: audit.EventLoginFailure, Username: token.Username, Error: err.Error()})
+		return "", throttledError(throttled)
+	}
+	err = s.performAuthentication(token)
+	if err != nil {
+		logger.Warn("Authentication failed", "user", token.Username, "token_type", token.TokenType, "error", err)
+		s.metrics.AuthenticationFailed(token.TokenType)
+		s.record(ctx, remoteAddr, audit.Event{Type: audit.EventLoginFailure, Username: token.Username, Error: err.Error()})
+		for scope, lockout := range s.limiter.Failure(remoteAddr, token.Username) {
+			logger.Warn("Authentication locked out", "scope", scope, "user", token.Username, "address", remoteAddr, "duration", lockout)
+			s.metrics.LockedOut(scope)
+		}
+		return "", unauthorized("not authorized")
+	}
+	s.limiter.Success(remoteAddr, token.Username)
+	// Key based logins open a new session, JWT based ones refresh the current session.
+	jwtToken, err := s.createToken(token.Username)
+	if err != nil {
+		return "", err
 	}
 	if token.TokenType == manager.TokenTypeKey {
-		jwtToken, err := s.createToken(token.Username)
-		if err != nil {
-			return err
+		s.record(ctx, remoteAddr, audit.Event{Type: audit.EventLoginSuccess, Username: token.Username})
+		s.record(ctx, remoteAddr, audit.Event{Type: audit.EventTokenIssued, Username: token.Username})
+	} else {
+		s.record(ctx, remoteAddr, audit.Event{Type: audit.EventTokenRefreshed, Username: token.Username})
+	}
+	return jwtToken, nil
+}
+
+// Hello is the handshake clients perform before anything else. It needs no authentication and
+// rejects clients speaking an incompatible protocol version.
+func (s *Server) Hello(r *http.Request, args *manager.HelloArgs, reply *manager.HelloResponse) error {
+	response, err := s.hello(r.Context(), args)
+	if err != nil {
+		return err
+	}
+	*reply = *response
+	return nil
+}
+
+func (s *Server) hello(ctx context.Context, args *manager.HelloArgs) (*manager.HelloResponse, error) {
+	logging.FromContext(ctx).Debug("Client connected", "client_version", args.ClientVersion, "protocol_version", args.ProtocolVersion)
+	err := manager.CheckProtocol(args.ProtocolVersion)
+	if err != nil {
+		return nil, err
+	}
+	response := &manager.HelloResponse{
+		ProtocolVersion: manager.ProtocolVersion,
+		ServerVersion:   manager.Version,
+		Modules:         map[string]manager.ModuleFeatures{},
+	}
+	for _, name := range s.moduleOrder {
+		features := manager.ModuleFeatures{Capabilities: []string{}}
+		if module, ok := s.modules[name].(modules.CapabilityModule); ok {
+			features.Capabilities = module.Capabilities()
 		}
-		response.Object = jwtToken
+		response.Modules[name] = features
+	}
+	return response, nil
+}
+
+// Logout revokes the session of the user, the given JWT stops being accepted immediately.
+func (s *Server) Logout(r *http.Request, args *manager.AuthenticationArgs, reply *manager.AuthenticationResponse) error {
+	err := s.logout(r.Context(), r.RemoteAddr, args.Token)
+	if err != nil {
+		return err
 	}
-	response.Status = http.StatusOK
-	*reply = response
+	reply.Status = http.StatusOK
 	return nil
 }
 
-func (s *Server) performAuthentication(token *manager.AuthenticationToken) (bool, error) {
-	authorized := false
+func (s *Server) logout(ctx context.Context, remoteAddr string, token *manager.AuthenticationToken) error {
+	if token == nil || token.TokenType != manager.TokenTypeJWT {
+		s.authenticationFailed(ctx, remoteAddr, token, audit.Event{Type: audit.EventTokenRevoked}, errors.New("no token provided"))
+		return unauthorized("no token provided")
+	}
+	err := s.performAuthentication(token)
+	if err != nil {
+		s.authenticationFailed(ctx, remoteAddr, token, audit.Event{Type: audit.EventTokenRevoked}, err)
+		return unauthorized("not authorized")
+	}
+	err = s.Sessions.Delete(token.Username)
+	if err != nil {
+		return err
+	}
+	s.record(ctx, remoteAddr, audit.Event{Type: audit.EventTokenRevoked, Username: token.Username})
+	return nil
+}
+
+func (s *Server) performAuthentication(token *manager.AuthenticationToken) error {
+	if token == nil {
+		return errors.New("no token provided")
+	}
 	switch token.TokenType {
 	case manager.TokenTypeKey:
-		authorized = s.AuthorizeUserWithKey(token.Username, token.Token)
+		return s.verifyKeySignature(token.Username, token.Token)
 	case manager.TokenTypeJWT:
-		authorized = s.AuthorizeUserWithToken(token.Username, string(token.Token))
-		if !authorized {
-			return false, errors.New("invalid token")
+		if !s.AuthorizeUserWithToken(token.Username, string(token.Token)) {
+			return errors.New("invalid token")
 		}
+		return nil
 	}
-	return authorized, nil
+	return errors.New("unsupported token type: " + token.TokenType)
 }
 
 func (s *Server) Synchronize(r *http.Request, args *manager.SynchronizationArgs, reply *manager.SynchronizationResponse) error {
-	var response manager.SynchronizationResponse
-	authorized, err := s.performAuthentication(args.Token)
-	if !authorized || err != nil {
-		return errors.New("not authorized, please re-run application")
+	response, err := s.synchronize(r.Context(), r.RemoteAddr, args)
+	if err != nil {
+		return err
 	}
-	if s.Configuration.Module != args.Module {
-		return errors.New("enabled module does not match given module: " + args.Module)
+	*reply = *response
+	return nil
+}
+
+// synchronize returns the state of a module to a client connected from remoteAddr over any transport.
+func (s *Server) synchronize(ctx context.Context, remoteAddr string, args *manager.SynchronizationArgs) (*manager.SynchronizationResponse, error) {
+	err := s.performAuthentication(args.Token)
+	if err != nil {
+		s.authenticationFailed(ctx, remoteAddr, args.Token, audit.Event{Type: audit.EventSyncRequest, Module: args.Module}, err)
+		return nil, unauthorized("not authorized, please sign in again")
+	}
+	event := audit.Event{Type: audit.EventSyncRequest, Username: args.Token.Username, Module: args.Module}
+	module, ok := s.modules[args.Module]
+	if !ok {
+		event.Error = "module is not enabled"
+		s.record(ctx, remoteAddr, event)
+		return nil, manager.NewError(manager.CodeNotFound, "module is not enabled: "+args.Module, map[string]any{"module": args.Module})
+	}
+	principal := s.Configuration.Principal(args.Token.Username)
+	if !s.Configuration.CanUseModule(principal, args.Module) {
+		event.Error = "access denied"
+		s.record(ctx, remoteAddr, event)
+		return nil, manager.NewError(manager.CodeForbidden, "access denied to module: "+args.Module, map[string]any{"module": args.Module})
+	}
+	s.record(ctx, remoteAddr, event)
+	logger := logging.FromContext(ctx)
+	logger.Info("Synchronization requested", "user", principal.Username, "module", args.Module)
+	response := &manager.SynchronizationResponse{Status: http.StatusOK}
+	response.Object, err = manager.EncodeSyncObject(module.Sync(principal))
+	var moduleError *manager.Error
+	if errors.As(err, &moduleError) {
+		// Sync objects of modules failing to synchronize, e.g. plugins, carry the error for the client.
+		logger.Warn("Module failed to synchronize", "module", args.Module, "error", moduleError)
+		return nil, moduleError
 	}
-	moduleName := args.Module
-	moduleInstance := modules.InitModuleHandler()
-	module, err := moduleInstance.GetModuleByName(moduleName)
 	if err != nil {
-		return errors.New("module not found: " + moduleName)
+		logger.Error("Encoding sync object failed", "module", args.Module, "error", err)
+		return nil, err
 	}
-	module.SetConfiguration(s.Configuration.ModuleSpecificConfig)
-	syncResponse := module.Sync()
-	response.Status = http.StatusOK
-	response.Object = &syncResponse
-	*reply = response
-	return nil
+	return response, nil
 }
 
+// authenticationFailed logs, counts and audits a call rejected because its token was not accepted,
+// recording event as failed.
+func (s *Server) authenticationFailed(ctx context.Context, remoteAddr string, token *manager.AuthenticationToken, event audit.Event, err error) {
+	tokenType := ""
+	if token != nil {
+		event.Username = token.Username
+		tokenType = token.TokenType
+	}
+	logging.FromContext(ctx).Warn("Authentication failed", "user", event.Username, "token_type", tokenType, "event", event.Type, "error", err)
+	s.metrics.AuthenticationFailed(tokenType)
+	event.Error = "authentication failed: " + err.Error()
+	s.record(ctx, remoteAddr, event)
+}
+
+// record appends the event to the audit log, attributing it to the address the call came from.
+func (s *Server) record(ctx context.Context, remoteAddr string, event audit.Event) {
+	event.RemoteAddr = remoteAddr
+	err := s.audit.Record(event)
+	if err != nil {
+		logging.FromContext(ctx).Error("Audit log write failed", "error", err)
+	}
+}
+
+// StartServer serves until the process is interrupted, it exits when the server cannot start or fails.
 func (s *Server) StartServer() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	// Restore default signal handling once shutting down, a second interrupt terminates immediately.
+	context.AfterFunc(ctx, stop)
+	err := s.Init(ctx)
+	if err != nil {
+		s.fatal("cannot start server", err)
+	}
+	err = s.Serve(ctx)
+	if err != nil {
+		s.fatal("server failed", err)
+	}
+}
+
+// Init opens the audit log, sets up the web services and starts the enabled modules. Event streams
+// are closed once ctx is done. Servers failing to initialize release what they already set up.
+func (s *Server) Init(ctx context.Context) error {
+	if s.Logger == nil {
+		s.Logger = slog.Default()
+	}
+	if s.Keys == nil {
+		s.Keys = NewFileKeyStore(manager.KeyBasePath)
+	}
+	if s.Sessions == nil {
+		s.Sessions = NewMemorySessionStore()
+	}
+	settings := s.Configuration.Server.WithDefaults()
 	rpcServer := rpc.NewServer()
-	rpcServer.RegisterCodec(jsonrpc.NewCodec(), "application/json")
+	rpcServer.RegisterCodec(json2.NewCustomCodecWithErrorMapper(rpc.DefaultEncoderSelector, rpcError), "application/json")
+	s.limiter = NewAuthenticationLimiter(settings.Authentication)
+	s.bandwidth = NewBandwidthLimiter(settings.Bandwidth)
+	s.metrics = NewMetrics(s)
+	rpcServer.RegisterAfterFunc(s.afterCall)
 	err := rpcServer.RegisterService(s, "")
 	if err != nil {
-		log.Fatal(err)
+		return fmt.Errorf("cannot register RPC service: %w", err)
+	}
+	if settings.GRPCAddress != "" {
+		s.grpcServer, err = s.newGRPCServer(settings.GRPCTLS)
+		if err != nil {
+			return fmt.Errorf("cannot set up gRPC: %w", err)
+		}
+	}
+	s.audit, err = audit.Open(settings.AuditLog)
+	if err != nil {
+		return fmt.Errorf("cannot open audit log: %w", err)
 	}
 	router := mux.NewRouter()
-	router.Handle("/", rpcServer)
+	router.Use(s.withRequestLogger)
+	router.Handle("/", compression.Handler(s.metrics.InstrumentRPC(rpcServer), maxRequestSize))
+	s.events = NewEventHub(s.Configuration)
+	context.AfterFunc(ctx, s.events.Close)
+	router.HandleFunc(eventsPath, s.HandleEvents).Methods(http.MethodGet)
+	router.Handle(metricsPath, s.metrics.Handler()).Methods(http.MethodGet)
+	router.HandleFunc(healthPath, s.HandleHealth).Methods(http.MethodGet)
+	router.HandleFunc(readinessPath, s.HandleReadiness).Methods(http.MethodGet)
 	// Registered module-specific routers, if any.
-	moduleName := s.Configuration.Module
-	moduleInstance := modules.InitModuleHandler()
-	module, err := moduleInstance.GetModuleByName(moduleName)
+	err = s.initModules(ctx, rpcServer, router, s.grpcServer)
 	if err != nil {
-		log.Fatal("module not found: " + moduleName)
+		s.Stop(ctx)
+		return fmt.Errorf("cannot initialize modules: %w", err)
 	}
-	module.SetConfiguration(s.Configuration.ModuleSpecificConfig)
-	if module, ok := module.(modules.WebServiceModule); ok {
-		err = rpcServer.RegisterService(module, "")
-		module.RegisterAsWebService(router, rpcServer)
+	s.handler = router
+	return nil
+}
+
+// Handler serves the JSON-RPC methods, the module web services, events, metrics and health checks.
+// It is available once Init succeeded, to be served by Serve or mounted on another server.
+func (s *Server) Handler() http.Handler {
+	return s.handler
+}
+
+// GRPCServer returns the gRPC server, nil unless a gRPC address is configured.
+func (s *Server) GRPCServer() *grpc.Server {
+	return s.grpcServer
+}
+
+// Serve listens on the configured addresses until ctx is done or serving fails. It then waits for
+// active transfers and stops the server.
+func (s *Server) Serve(ctx context.Context) error {
+	settings := s.Configuration.Server.WithDefaults()
+	httpServer := &http.Server{
+		Handler:      s.handler,
+		ReadTimeout:  settings.ReadTimeout,
+		WriteTimeout: settings.WriteTimeout,
+		IdleTimeout:  settings.IdleTimeout,
+		ErrorLog:     slog.NewLogLogger(s.Logger.Handler(), slog.LevelWarn),
+	}
+	// Event streams never finish on their own, close them so shutdown only waits for transfers.
+	httpServer.RegisterOnShutdown(s.events.Close)
+	err := s.serve(ctx, httpServer, settings)
+
+	s.Logger.Info("Shutting down, waiting for active transfers...", "timeout", settings.ShutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), settings.ShutdownTimeout)
+	defer cancel()
+	var grpcStopped sync.WaitGroup
+	if s.grpcServer != nil {
+		grpcStopped.Add(1)
+		go func() {
+			defer grpcStopped.Done()
+			s.stopGRPC(shutdownCtx, s.grpcServer)
+		}()
+	}
+	shutdownErr := httpServer.Shutdown(shutdownCtx)
+	if shutdownErr != nil {
+		s.Logger.Warn("Active transfers did not finish in time", "error", shutdownErr)
+		_ = httpServer.Close()
 	}
+	grpcStopped.Wait()
+	// Transfers may have used up the shutdown timeout, modules get a deadline of their own.
+	stopCtx, cancelStop := context.WithTimeout(context.Background(), settings.ShutdownTimeout)
+	defer cancelStop()
+	s.Stop(stopCtx)
+	s.Logger.Info("Server stopped")
+	return err
+}
+
+// serve handles HTTP and gRPC requests until ctx is done or serving fails.
+func (s *Server) serve(ctx context.Context, httpServer *http.Server, settings manager.ServerConfiguration) error {
+	listener, err := listen(settings.Address)
 	if err != nil {
-		log.Fatal(err)
+		return fmt.Errorf("cannot listen on %s: %w", settings.Address, err)
 	}
-	log.Println("Started on port", port)
-	fmt.Println("To close connection CTRL+C")
-	err = http.ListenAndServe(port, router)
+	serveErrors := make(chan error, 2)
+	go func() {
+		serveErrors <- httpServer.Serve(listener)
+	}()
+	if s.grpcServer != nil {
+		grpcListener, err := listen(settings.GRPCAddress)
+		if err != nil {
+			return fmt.Errorf("cannot listen on %s: %w", settings.GRPCAddress, err)
+		}
+		go func() {
+			serveErrors <- s.grpcServer.Serve(grpcListener)
+		}()
+		s.Logger.Info("Serving gRPC", "address", settings.GRPCAddress)
+	}
+	s.Logger.Info("Started, to close connection CTRL+C", "address", settings.Address,
+		"bandwidth", settings.Bandwidth.Global, "client_bandwidth", settings.Bandwidth.PerClient)
+	select {
+	case err = <-serveErrors:
+		if errors.Is(err, http.ErrServerClosed) {
+			return nil
+		}
+		return err
+	case <-ctx.Done():
+		return nil
+	}
+}
+
+// Stop closes event streams, stops the modules and closes the audit log. Serve stops the server on
+// its own, servers mounted with Handler are stopped once they no longer handle requests.
+func (s *Server) Stop(ctx context.Context) {
+	s.events.Close()
+	s.stopModules(ctx)
+	err := s.audit.Close()
 	if err != nil {
-		log.Fatal(err)
+		s.Logger.Warn("Closing audit log failed", "error", err)
+	}
+}
+
+// withRequestLogger tags every request with an id, reusing the one sent by the client,
+// and makes a logger carrying it available to handlers through the request context.
+func (s *Server) withRequestLogger(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(logging.HeaderRequestID)
+		if requestID == "" || len(requestID) > 64 {
+			requestID = uuid.New().String()
+		}
+		w.Header().Set(logging.HeaderRequestID, requestID)
+		logger := s.Logger.With(logging.KeyRequestID, requestID)
+		ctx := logging.WithLogger(withRequestStart(r.Context()), logger)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func (s *Server) fatal(message string, err error) {
+	s.Logger.Error(message, "error", err)
+	os.Exit(1)
+}
+
+// moduleConfiguration decodes the config section of a module, modules of the embedding program
+// decode their own in SetConfiguration.
+func (s *Server) moduleConfiguration(moduleName string, config any) (any, error) {
+	for _, module := range s.ExtraModules {
+		if module.GetId() == moduleName {
+			return config, nil
+		}
+	}
+	return modules.DecodeConfiguration(moduleName, config)
+}
+
+// initModules configures every enabled module, registers its web services and starts it.
+func (s *Server) initModules(ctx context.Context, rpcServer *rpc.Server, router *mux.Router, grpcServer *grpc.Server) error {
+	enabledModules := s.Configuration.EnabledModules()
+	if len(enabledModules) == 0 {
+		return errors.New("no modules enabled")
+	}
+	moduleHandler := modules.InitModuleHandler()
+	for _, module := range s.ExtraModules {
+		moduleHandler.Register(module)
+	}
+	err := plugin.Load(moduleHandler, s.Configuration.Plugins)
+	if err != nil {
+		return err
+	}
+	// Servers initialized again after being stopped start over with the modules of the configuration.
+	s.modules = map[string]modules.Module{}
+	s.moduleOrder = nil
+	for _, moduleConfiguration := range enabledModules {
+		moduleName := moduleConfiguration.ID
+		module, err := moduleHandler.GetModuleByName(moduleName)
+		if err != nil {
+			return errors.New("module not found: " + moduleName)
+		}
+		config, err := s.moduleConfiguration(moduleName, moduleConfiguration.Config)
+		if err != nil {
+			return err
+		}
+		err = module.SetConfiguration(config)
+		if err != nil {
+			return fmt.Errorf("invalid configuration of module %s: %w", moduleName, err)
+		}
+		if module, ok := module.(modules.LoggingModule); ok {
+			module.SetLogger(s.Logger.With("module", moduleName))
+		}
+		if module, ok := module.(modules.AuditedModule); ok {
+			module.SetAuditLog(s.audit)
+		}
+		if module, ok := module.(modules.GroupAwareModule); ok {
+			for _, group := range s.Configuration.Groups {
+				for _, groupModule := range group.Modules {
+					if groupModule.ID != moduleName {
+						continue
+					}
+					config, err := s.moduleConfiguration(moduleName, groupModule.Config)
+					if err != nil {
+						return fmt.Errorf("group %s: %w", group.Name, err)
+					}
+					err = module.SetGroupConfiguration(group.Name, config)
+					if err != nil {
+						return fmt.Errorf("group %s: invalid configuration of module %s: %w", group.Name, moduleName, err)
+					}
+				}
+			}
+		}
+		if module, ok := module.(modules.ObservableModule); ok {
+			module.Observe(func() {
+				s.events.Publish(manager.Event{Type: manager.EventModuleChanged, Module: moduleName})
+			})
+		}
+		if module, ok := module.(modules.MetricsModule); ok {
+			err = module.RegisterMetrics(s.metrics.Registry)
+			if err != nil {
+				return errors.New("module " + moduleName + " failed to register metrics: " + err.Error())
+			}
+		}
+		if module, ok := module.(modules.WebServiceModule); ok {
+			err = rpcServer.RegisterService(module, "")
+			if err != nil {
+				return err
+			}
+			moduleRouter := router.NewRoute().Subrouter()
+			moduleRouter.Use(s.metrics.InstrumentModule(moduleName), s.bandwidth.Limit)
+			module.RegisterAsWebService(moduleRouter, rpcServer)
+		}
+		if module, ok := module.(modules.GRPCModule); ok && grpcServer != nil {
+			module.RegisterGRPCService(grpcServer)
+		}
+		if module, ok := module.(modules.LifecycleModule); ok {
+			err = module.Start(ctx)
+			if err != nil {
+				return errors.New("module " + moduleName + " failed to start: " + err.Error())
+			}
+		}
+		s.modules[moduleName] = module
+		s.moduleOrder = append(s.moduleOrder, moduleName)
+		s.Logger.Info("Enabled module", "module", moduleName)
+	}
+	return nil
+}
+
+// stopModules stops the started modules in reverse order.
+func (s *Server) stopModules(ctx context.Context) {
+	for i := len(s.moduleOrder) - 1; i >= 0; i-- {
+		moduleName := s.moduleOrder[i]
+		module, ok := s.modules[moduleName].(modules.LifecycleModule)
+		if !ok {
+			continue
+		}
+		err := module.Stop(ctx)
+		if err != nil {
+			s.Logger.Warn("Module failed to stop", "module", moduleName, "error", err)
+		}
 	}
 }
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"context"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/rpc/v2"
+	"io"
+	manager "lazysync/application/service"
+	"lazysync/modules"
+	"log/slog"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TransferModule serves GET /transfer, which only finishes once the connection is closed, and
+// reports the time left to stop it. It is exported as the server registers it as JSON-RPC service.
+type TransferModule struct {
+	started chan struct{}
+	stopped chan time.Duration // Zero when stopped without deadline or with an expired one.
+}
+
+func (*TransferModule) GetId() string                                             { return "transfer" }
+func (*TransferModule) SetupModule()                                              {}
+func (*TransferModule) GetConfigurationValues() interface{}                       { return map[string]any{} }
+func (*TransferModule) SetConfiguration(interface{}) error                        { return nil }
+func (*TransferModule) Sync(*manager.Principal) manager.SyncObject                { return &manager.BaseSyncObject{} }
+func (*TransferModule) GetSyncObjectInstance() manager.SyncObject                 { return &manager.BaseSyncObject{} }
+func (*TransferModule) ExecuteCommands(context.Context, manager.SyncObject) error { return nil }
+func (*TransferModule) Start(context.Context) error                               { return nil }
+
+func (m *TransferModule) Stop(ctx context.Context) error {
+	var left time.Duration
+	if deadline, ok := ctx.Deadline(); ok && ctx.Err() == nil {
+		left = time.Until(deadline)
+	}
+	m.stopped <- left
+	return nil
+}
+
+func (*TransferModule) Ping(_ *http.Request, _ *struct{}, reply *string) error {
+	*reply = "pong"
+	return nil
+}
+
+func (m *TransferModule) RegisterAsWebService(router *mux.Router, _ *rpc.Server) {
+	router.HandleFunc("/transfer", func(w http.ResponseWriter, r *http.Request) {
+		close(m.started)
+		<-r.Context().Done()
+	}).Methods(http.MethodGet)
+}
+
+func TestServeGivesModulesTheirOwnDeadline(t *testing.T) {
+	const shutdownTimeout = 300 * time.Millisecond
+	socket := filepath.Join(t.TempDir(), "lazysync.sock")
+	module := &TransferModule{started: make(chan struct{}), stopped: make(chan time.Duration, 1)}
+	s := &Server{
+		Configuration: &manager.AppConfiguration{Modules: []manager.ModuleConfiguration{{ID: module.GetId()}}},
+		ExtraModules:  []modules.Module{module},
+		Logger:        slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+	s.Configuration.Server.Address = unixScheme + socket
+	s.Configuration.Server.ShutdownTimeout = shutdownTimeout
+	s.Configuration.Server.AuditLog = filepath.Join(t.TempDir(), "audit.log")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	err := s.Init(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	served := make(chan error, 1)
+	go func() {
+		served <- s.Serve(ctx)
+	}()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+		},
+	}}
+	go func() {
+		for {
+			response, err := client.Get("http://lazysync/transfer")
+			if err == nil {
+				_ = response.Body.Close()
+				return
+			}
+			select {
+			case <-module.started:
+				return
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+	}()
+	select {
+	case <-module.started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the transfer did not start")
+	}
+	// The transfer uses up the shutdown timeout.
+	cancel()
+	select {
+	case left := <-module.stopped:
+		if left < shutdownTimeout/2 {
+			t.Errorf("the module was stopped with %s left, want about %s", left, shutdownTimeout)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the module was not stopped")
+	}
+	err = <-served
+	if err != nil {
+		t.Errorf("Serve failed: %v", err)
+	}
+}
@@ -0,0 +1,100 @@
+package server
+
+import (
+	"crypto/rsa"
+	"errors"
+	manager "lazysync/application/service"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// KeyStore provides the public keys users sign their logins with.
+type KeyStore interface {
+	PublicKey(username string) (*rsa.PublicKey, error)
+}
+
+// SessionStore keeps the secrets signing the session tokens of signed in users. A user holds a
+// single session, storing a new secret replaces the previous one. Stores shared by several servers
+// let users sign in on one of them and synchronize with another.
+type SessionStore interface {
+	// Secret returns the secret of the session of the user, nil when the user holds none.
+	Secret(username string) ([]byte, error)
+	Store(username string, secret []byte) error
+	Delete(username string) error
+	// Count returns the amount of active sessions, reported by the metrics endpoint.
+	Count() (int, error)
+}
+
+// healthCheckedStore is implemented by stores reporting their state on the readiness endpoint.
+type healthCheckedStore interface {
+	CheckHealth() error
+}
+
+// FileKeyStore reads keys from <Directory>/<username>/key.rsa.pub, the layout written by setup.
+type FileKeyStore struct {
+	Directory string
+}
+
+func NewFileKeyStore(directory string) *FileKeyStore {
+	return &FileKeyStore{Directory: directory}
+}
+
+func (k *FileKeyStore) PublicKey(username string) (*rsa.PublicKey, error) {
+	return manager.LoadPublicKeyFrom(k.Directory, username)
+}
+
+// CheckHealth makes sure the public key of every user can be read, otherwise they cannot sign in.
+func (k *FileKeyStore) CheckHealth() error {
+	entries, err := os.ReadDir(k.Directory)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, entry := range entries {
+		if !entry.IsDir() || entry.Name() == Type {
+			continue
+		}
+		_, err = k.PublicKey(entry.Name())
+		if err != nil {
+			errs = append(errs, errors.New(filepath.Join(k.Directory, entry.Name())+": "+err.Error()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// MemorySessionStore keeps sessions in memory, they are lost when the server restarts.
+type MemorySessionStore struct {
+	lock     sync.RWMutex
+	sessions map[string][]byte
+}
+
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{sessions: map[string][]byte{}}
+}
+
+func (m *MemorySessionStore) Secret(username string) ([]byte, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return m.sessions[username], nil
+}
+
+func (m *MemorySessionStore) Store(username string, secret []byte) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.sessions[username] = secret
+	return nil
+}
+
+func (m *MemorySessionStore) Delete(username string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	delete(m.sessions, username)
+	return nil
+}
+
+func (m *MemorySessionStore) Count() (int, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return len(m.sessions), nil
+}
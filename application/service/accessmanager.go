@@ -0,0 +1,75 @@
+package service
+
+import (
+	"slices"
+	"strings"
+)
+
+// SubjectEveryone matches every authenticated user in access lists.
+const SubjectEveryone = "*"
+
+// GroupPrefix marks group names in access lists, e.g. "@ops".
+const GroupPrefix = "@"
+
+// Principal is an authenticated user together with the groups it belongs to.
+type Principal struct {
+	Username string
+	Groups   []string
+}
+
+// Matches reports whether the principal is listed in subjects, directly, through one of its groups or with "*".
+func (p *Principal) Matches(subjects []string) bool {
+	for _, subject := range subjects {
+		switch {
+		case subject == SubjectEveryone:
+			return true
+		case strings.HasPrefix(subject, GroupPrefix):
+			if slices.Contains(p.Groups, strings.TrimPrefix(subject, GroupPrefix)) {
+				return true
+			}
+		case subject == p.Username:
+			return true
+		}
+	}
+	return false
+}
+
+// GroupConfiguration names a set of users. Modules listed for a group extend the module's
+// configuration for the group members, e.g. with files only some hosts should receive.
+type GroupConfiguration struct {
+	Name    string                `yaml:"name"`
+	Users   []string              `yaml:"users"`
+	Modules []ModuleConfiguration `yaml:"modules,omitempty"`
+}
+
+// AccessRule lists the users and "@groups" allowed to use a module.
+type AccessRule struct {
+	Module string   `yaml:"module"`
+	Allow  []string `yaml:"allow"`
+}
+
+// Principal resolves the groups of the given user.
+func (c *AppConfiguration) Principal(username string) *Principal {
+	principal := &Principal{Username: username}
+	for _, group := range c.Groups {
+		if slices.Contains(group.Users, username) {
+			principal.Groups = append(principal.Groups, group.Name)
+		}
+	}
+	return principal
+}
+
+// CanUseModule reports whether the principal may synchronize the module. Without any access
+// rules every authenticated user may use every module, once rules are configured modules
+// without a matching rule are denied.
+func (c *AppConfiguration) CanUseModule(principal *Principal, module string) bool {
+	if len(c.Access) == 0 {
+		return true
+	}
+	for _, rule := range c.Access {
+		if rule.Module == module && principal.Matches(rule.Allow) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,183 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ConfigDefaults is implemented by pointers to module configuration types filling in unset values.
+// DecodeModuleConfiguration calls SetDefaults before validating the configuration.
+type ConfigDefaults interface {
+	SetDefaults()
+}
+
+// ConfigValidator is implemented by module configuration types rejecting invalid values.
+type ConfigValidator interface {
+	Validate() error
+}
+
+// ConfigError is a problem found in a configuration file. Line is 0 when unknown, e.g. for
+// configurations not read from a file.
+type ConfigError struct {
+	Line    int
+	Field   string // Path of the setting, e.g. modules[0].config, empty when unknown.
+	Message string
+}
+
+func (e *ConfigError) Error() string {
+	location := ""
+	if e.Line > 0 {
+		location = "line " + strconv.Itoa(e.Line) + ": "
+	}
+	if e.Field != "" {
+		location += e.Field + ": "
+	}
+	return location + e.Message
+}
+
+// typeErrorLine matches the messages of yaml.TypeError, which start with the line they refer to.
+var typeErrorLine = regexp.MustCompile(`^line (\d+): (.*)$`)
+
+// ConfigErrors splits an error of decoding a YAML document into an error per problem.
+func ConfigErrors(err error) []*ConfigError {
+	var typeError *yaml.TypeError
+	if errors.As(err, &typeError) {
+		configErrors := make([]*ConfigError, 0, len(typeError.Errors))
+		for _, message := range typeError.Errors {
+			configErrors = append(configErrors, newConfigError(message))
+		}
+		return configErrors
+	}
+	var configError *ConfigError
+	if errors.As(err, &configError) {
+		return []*ConfigError{configError}
+	}
+	if err != nil {
+		return []*ConfigError{newConfigError(strings.TrimPrefix(err.Error(), "yaml: "))}
+	}
+	return nil
+}
+
+func newConfigError(message string) *ConfigError {
+	match := typeErrorLine.FindStringSubmatch(message)
+	if match == nil {
+		return &ConfigError{Message: message}
+	}
+	line, _ := strconv.Atoi(match[1])
+	return &ConfigError{Line: line, Message: match[2]}
+}
+
+// KnownFields reports the keys of mappings in node without a matching field in the type of target,
+// recursively, like yaml.Decoder.KnownFields does for whole documents. yaml.Node.Decode offers no
+// such check. Values within target implementing yaml.Unmarshaler check their own keys, calling
+// KnownFields from UnmarshalYAML. The result is a *yaml.TypeError, so decoders can report it among
+// their own errors.
+func KnownFields(node *yaml.Node, target any) error {
+	var messages []string
+	checkFields(node, reflect.TypeOf(target), true, &messages)
+	if len(messages) == 0 {
+		return nil
+	}
+	return &yaml.TypeError{Errors: messages}
+}
+
+// DecodeNode decodes node into target like yaml.Node.Decode, also rejecting unknown keys.
+func DecodeNode(node *yaml.Node, target any) error {
+	unknown := KnownFields(node, target)
+	err := node.Decode(target)
+	var typeError *yaml.TypeError
+	if unknown == nil || (err != nil && !errors.As(err, &typeError)) {
+		return err
+	}
+	messages := unknown.(*yaml.TypeError).Errors
+	if typeError != nil {
+		messages = append(messages, typeError.Errors...)
+	}
+	return &yaml.TypeError{Errors: messages}
+}
+
+var unmarshalerType = reflect.TypeOf((*yaml.Unmarshaler)(nil)).Elem()
+
+func checkFields(node *yaml.Node, t reflect.Type, top bool, messages *[]string) {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if !top && (t.Implements(unmarshalerType) || reflect.PointerTo(t).Implements(unmarshalerType)) {
+		return
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		if node.Kind != yaml.MappingNode {
+			return
+		}
+		fields := yamlFields(t)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			field, ok := fields[key.Value]
+			if !ok {
+				*messages = append(*messages, fmt.Sprintf("line %d: field %s not found in type %s", key.Line, key.Value, t))
+				continue
+			}
+			checkFields(value, field, false, messages)
+		}
+	case reflect.Slice, reflect.Array:
+		if node.Kind != yaml.SequenceNode {
+			return
+		}
+		for _, item := range node.Content {
+			checkFields(item, t.Elem(), false, messages)
+		}
+	case reflect.Map:
+		if node.Kind != yaml.MappingNode {
+			return
+		}
+		for i := 1; i < len(node.Content); i += 2 {
+			checkFields(node.Content[i], t.Elem(), false, messages)
+		}
+	}
+}
+
+// yamlFields returns the types of the fields of a struct by their key, following the rules of yaml.v3.
+func yamlFields(t reflect.Type) map[string]reflect.Type {
+	fields := map[string]reflect.Type{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, options, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		if name == "-" {
+			continue
+		}
+		if slices.Contains(strings.Split(options, ","), "inline") {
+			for key, inlined := range yamlFields(field.Type) {
+				fields[key] = inlined
+			}
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+		fields[name] = field.Type
+	}
+	return fields
+}
+
+// withoutLines drops the line numbers from the messages of err.
+func withoutLines(err error) error {
+	configErrors := ConfigErrors(err)
+	messages := make([]string, 0, len(configErrors))
+	for _, configError := range configErrors {
+		messages = append(messages, configError.Message)
+	}
+	return errors.New(strings.Join(messages, "; "))
+}
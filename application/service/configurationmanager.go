@@ -1,18 +1,249 @@
 package service
 
 import (
+	"bytes"
+	"errors"
 	"gopkg.in/yaml.v3"
-	"log"
+	"io"
+	"io/fs"
+	"lazysync/application/audit"
+	"lazysync/application/bandwidth"
+	"log/slog"
 	"os"
+	"slices"
+	"strings"
+	"time"
 )
 
 const ConfigFile = "config.yaml"
 
+const DefaultServerAddress = ":8080"
+
+const DefaultServerUrl = "http://localhost:8080"
+
 type AppConfiguration struct {
-	Mode                 string      `yaml:"mode"`
-	Username             string      `yaml:"username"`
-	Module               string      `yaml:"module"`
-	ModuleSpecificConfig interface{} `yaml:"config"`
+	Mode                 string                  `yaml:"mode"`
+	Username             string                  `yaml:"username"`
+	ServerUrl            string                  `yaml:"server_url,omitempty"` // Server clients connect to.
+	Module               string                  `yaml:"module,omitempty"`     // Single module layout, kept for older configs.
+	ModuleSpecificConfig interface{}             `yaml:"config,omitempty"`
+	Modules              []ModuleConfiguration   `yaml:"modules,omitempty"`
+	Server               ServerConfiguration     `yaml:"server,omitempty"`
+	Groups               []GroupConfiguration    `yaml:"groups,omitempty"`
+	Access               []AccessRule            `yaml:"access,omitempty"`
+	Log                  LogConfiguration        `yaml:"log,omitempty"`
+	Connection           ConnectionConfiguration `yaml:"connection,omitempty"`
+	Plugins              PluginConfiguration     `yaml:"plugins,omitempty"`
+}
+
+// LogConfiguration selects the log level (debug, info, warn, error) and format (text, json).
+type LogConfiguration struct {
+	Level  string `yaml:"level,omitempty"`
+	Format string `yaml:"format,omitempty"`
+}
+
+// ConnectionConfiguration tunes the requests of the client. Timeout bounds a whole request including
+// the transfer of the response, except for file transfers, which only fail once no data arrived for
+// IdleTimeout, so large files can take as long as they need. Idempotent requests are retried Retries times on network errors and
+// server failures, waiting RetryDelay doubled on every attempt up to MaxRetryDelay; a negative amount
+// of retries disables them. Proxy is the url of an HTTP proxy, "direct" to connect without one;
+// when unset the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables apply. Transport is
+// jsonrpc (default) or grpc, the latter connecting to GRPCAddress, host:port or unix:///path, with
+// GRPCTLS.
+type ConnectionConfiguration struct {
+	ConnectTimeout time.Duration    `yaml:"connect_timeout,omitempty"`
+	Timeout        time.Duration    `yaml:"timeout,omitempty"`
+	IdleTimeout    time.Duration    `yaml:"idle_timeout,omitempty"`
+	Retries        int              `yaml:"retries,omitempty"`
+	RetryDelay     time.Duration    `yaml:"retry_delay,omitempty"`
+	MaxRetryDelay  time.Duration    `yaml:"max_retry_delay,omitempty"`
+	Proxy          string           `yaml:"proxy,omitempty"`
+	Transport      string           `yaml:"transport,omitempty"`
+	GRPCAddress    string           `yaml:"grpc_address,omitempty"`
+	GRPCTLS        TLSConfiguration `yaml:"grpc_tls,omitempty"`
+}
+
+// TLSConfiguration secures gRPC connections. Servers present the certificate in CertFile with the
+// key in KeyFile. Clients verify the server against the certificates in CAFile, the system roots
+// when unset, expecting ServerName, the host of the address when unset. Insecure uses plaintext
+// instead, it has to be set explicitly, e.g. for unix sockets or behind a proxy terminating TLS.
+type TLSConfiguration struct {
+	CertFile   string `yaml:"cert_file,omitempty"`
+	KeyFile    string `yaml:"key_file,omitempty"`
+	CAFile     string `yaml:"ca_file,omitempty"`
+	ServerName string `yaml:"server_name,omitempty"`
+	Insecure   bool   `yaml:"insecure,omitempty"`
+}
+
+// Transports clients talk to servers with.
+const (
+	TransportJSONRPC = "jsonrpc"
+	TransportGRPC    = "grpc"
+)
+
+// WithDefaults returns a copy of the settings with every unset value replaced by its default.
+func (c ConnectionConfiguration) WithDefaults() ConnectionConfiguration {
+	if c.ConnectTimeout == 0 {
+		c.ConnectTimeout = 10 * time.Second
+	}
+	if c.Timeout == 0 {
+		c.Timeout = 5 * time.Minute
+	}
+	if c.IdleTimeout == 0 {
+		c.IdleTimeout = time.Minute
+	}
+	if c.Retries == 0 {
+		c.Retries = 3
+	}
+	if c.Retries < 0 {
+		c.Retries = 0
+	}
+	if c.RetryDelay == 0 {
+		c.RetryDelay = 500 * time.Millisecond
+	}
+	if c.MaxRetryDelay == 0 {
+		c.MaxRetryDelay = 10 * time.Second
+	}
+	if c.Transport == "" {
+		c.Transport = TransportJSONRPC
+	}
+	return c
+}
+
+// GetServerUrl returns the configured server url or the default one.
+func (c *AppConfiguration) GetServerUrl() string {
+	if c.ServerUrl == "" {
+		return DefaultServerUrl
+	}
+	return strings.TrimSuffix(c.ServerUrl, "/")
+}
+
+// ModuleConfiguration enables a module with its module specific config section, which clients
+// only need for modules configured on their side too, e.g. the installed version for the updater.
+type ModuleConfiguration struct {
+	ID     string      `yaml:"id"`
+	Config interface{} `yaml:"config,omitempty"`
+}
+
+// EnabledModules returns every enabled module, including the one set with the single module layout.
+func (c *AppConfiguration) EnabledModules() []ModuleConfiguration {
+	enabled := slices.Clone(c.Modules)
+	if c.Module != "" && c.FindModule(c.Module) == nil {
+		enabled = append(enabled, ModuleConfiguration{ID: c.Module, Config: c.ModuleSpecificConfig})
+	}
+	return enabled
+}
+
+// FindModule returns the entry of the modules list with the given id, if any.
+func (c *AppConfiguration) FindModule(id string) *ModuleConfiguration {
+	for i := range c.Modules {
+		if c.Modules[i].ID == id {
+			return &c.Modules[i]
+		}
+	}
+	return nil
+}
+
+// EnableModule adds the module to the enabled ones, replacing its config if it is already enabled.
+func (c *AppConfiguration) EnableModule(id string, config interface{}) {
+	if module := c.FindModule(id); module != nil {
+		module.Config = config
+		return
+	}
+	c.Modules = append(c.Modules, ModuleConfiguration{ID: id, Config: config})
+}
+
+// PluginConfiguration enables the module plugins found in Directory, see lazysync/modules/plugin.
+// Every call to a plugin is bounded by Timeout, at most MaxConcurrent calls of a plugin run at once
+// and further calls wait for one of them to finish, within their timeout.
+type PluginConfiguration struct {
+	Directory     string        `yaml:"directory,omitempty"` // Plugins are disabled when unset.
+	Timeout       time.Duration `yaml:"timeout,omitempty"`
+	MaxConcurrent int           `yaml:"max_concurrent,omitempty"`
+}
+
+// WithDefaults returns a copy of the settings with every unset value replaced by its default.
+func (c PluginConfiguration) WithDefaults() PluginConfiguration {
+	if c.Timeout == 0 {
+		c.Timeout = 30 * time.Second
+	}
+	if c.MaxConcurrent <= 0 {
+		c.MaxConcurrent = 4
+	}
+	return c
+}
+
+// ServerConfiguration holds the HTTP server settings, unset values fall back to defaults.
+type ServerConfiguration struct {
+	Address         string               `yaml:"address,omitempty"`
+	GRPCAddress     string               `yaml:"grpc_address,omitempty"` // gRPC endpoint, disabled when unset.
+	GRPCTLS         TLSConfiguration     `yaml:"grpc_tls,omitempty"`
+	ReadTimeout     time.Duration        `yaml:"read_timeout,omitempty"`
+	WriteTimeout    time.Duration        `yaml:"write_timeout,omitempty"` // Zero keeps long transfers unlimited.
+	IdleTimeout     time.Duration        `yaml:"idle_timeout,omitempty"`
+	ShutdownTimeout time.Duration        `yaml:"shutdown_timeout,omitempty"` // Time given to active transfers on shutdown, then to modules to stop.
+	AuditLog        string               `yaml:"audit_log,omitempty"`
+	Authentication  AuthenticationLimits `yaml:"authentication,omitempty"`
+	Bandwidth       BandwidthLimits      `yaml:"bandwidth,omitempty"`
+}
+
+// AuthenticationLimits throttles login attempts. Rates are attempts per minute, after MaxFailures
+// consecutive failures the address or user is locked out for Lockout, doubled on every further
+// failure up to MaxLockout. Users are limited per address they connect from, failures elsewhere
+// never lock a user out.
+type AuthenticationLimits struct {
+	AddressRate int           `yaml:"address_rate,omitempty"`
+	UserRate    int           `yaml:"user_rate,omitempty"`
+	Burst       int           `yaml:"burst,omitempty"`
+	MaxFailures int           `yaml:"max_failures,omitempty"`
+	Lockout     time.Duration `yaml:"lockout,omitempty"`
+	MaxLockout  time.Duration `yaml:"max_lockout,omitempty"`
+}
+
+// BandwidthLimits caps the throughput of module transfers, for all clients together and for each
+// client address. Unset limits are unlimited.
+type BandwidthLimits struct {
+	Global    bandwidth.Rate `yaml:"global,omitempty"`
+	PerClient bandwidth.Rate `yaml:"per_client,omitempty"`
+}
+
+// WithDefaults returns a copy of the settings with every unset value replaced by its default.
+func (c ServerConfiguration) WithDefaults() ServerConfiguration {
+	if c.Address == "" {
+		c.Address = DefaultServerAddress
+	}
+	if c.ReadTimeout == 0 {
+		c.ReadTimeout = 30 * time.Second
+	}
+	if c.IdleTimeout == 0 {
+		c.IdleTimeout = 2 * time.Minute
+	}
+	if c.ShutdownTimeout == 0 {
+		c.ShutdownTimeout = 30 * time.Second
+	}
+	if c.AuditLog == "" {
+		c.AuditLog = audit.DefaultPath
+	}
+	limits := &c.Authentication
+	if limits.AddressRate == 0 {
+		limits.AddressRate = 30
+	}
+	if limits.UserRate == 0 {
+		limits.UserRate = 10
+	}
+	if limits.Burst == 0 {
+		limits.Burst = 5
+	}
+	if limits.MaxFailures == 0 {
+		limits.MaxFailures = 5
+	}
+	if limits.Lockout == 0 {
+		limits.Lockout = time.Minute
+	}
+	if limits.MaxLockout == 0 {
+		limits.MaxLockout = time.Hour
+	}
+	return c
 }
 
 func SaveConfiguration(configuration *AppConfiguration) {
@@ -27,14 +258,81 @@ func SaveConfiguration(configuration *AppConfiguration) {
 }
 
 func LoadConfiguration() *AppConfiguration {
-	var config AppConfiguration
+	config, err := ReadOptionalConfiguration()
+	if err != nil {
+		slog.Error("Cannot parse configuration", "file", ConfigFile, "error", err)
+		os.Exit(1)
+	}
+	return config
+}
+
+// ReadConfiguration reads and parses the configuration file, returning an error
+// instead of terminating the process, so long-running modes can reload it safely.
+func ReadConfiguration() (*AppConfiguration, error) {
 	yamlFile, err := os.ReadFile(ConfigFile)
 	if err != nil {
-		log.Printf("yamlFile.Get err   #%v ", err)
+		return nil, err
+	}
+	return ParseConfiguration(yamlFile)
+}
+
+// ReadOptionalConfiguration reads the configuration file like ReadConfiguration, returning an
+// empty configuration when there is none, e.g. before setup wrote it.
+func ReadOptionalConfiguration() (*AppConfiguration, error) {
+	config, err := ReadConfiguration()
+	if errors.Is(err, fs.ErrNotExist) {
+		slog.Warn("No configuration found, using defaults", "file", ConfigFile)
+		return &AppConfiguration{}, nil
 	}
-	err = yaml.Unmarshal(yamlFile, &config)
+	return config, err
+}
+
+// ParseConfiguration parses the contents of a configuration file, rejecting unknown settings.
+// Module config sections are checked by the modules decoding them.
+func ParseConfiguration(contents []byte) (*AppConfiguration, error) {
+	var config AppConfiguration
+	decoder := yaml.NewDecoder(bytes.NewReader(contents))
+	decoder.KnownFields(true)
+	err := decoder.Decode(&config)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// DecodeModuleConfiguration converts the generic module config section into the module's own
+// configuration type, see DecodeModuleNode.
+func DecodeModuleConfiguration(configuration interface{}, target interface{}) error {
+	yamlContents, err := yaml.Marshal(configuration)
 	if err != nil {
-		log.Fatalf("Unmarshal: %v", err)
+		return err
+	}
+	var document yaml.Node
+	err = yaml.Unmarshal(yamlContents, &document)
+	if err != nil {
+		return err
+	}
+	err = DecodeModuleNode(document.Content[0], target)
+	if err != nil {
+		// Lines refer to the re-encoded section, not to the configuration file.
+		return withoutLines(err)
+	}
+	return nil
+}
+
+// DecodeModuleNode decodes a module config section into target, a pointer to the configuration
+// type of the module. Unknown keys are rejected, then the defaults of target are set and the
+// result is validated when target implements ConfigDefaults and ConfigValidator.
+func DecodeModuleNode(node *yaml.Node, target interface{}) error {
+	err := DecodeNode(node, target)
+	if err != nil {
+		return err
+	}
+	if defaults, ok := target.(ConfigDefaults); ok {
+		defaults.SetDefaults()
+	}
+	if validator, ok := target.(ConfigValidator); ok {
+		return validator.Validate()
 	}
-	return &config
+	return nil
 }
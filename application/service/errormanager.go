@@ -0,0 +1,58 @@
+package service
+
+import "fmt"
+
+// JSONRPCVersion is the value of the jsonrpc member of every request and response.
+const JSONRPCVersion = "2.0"
+
+// Error codes of the JSON-RPC 2.0 specification.
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+)
+
+// Error codes defined by lazysync, in the range the specification reserves for servers.
+const (
+	CodeServerError          = -32000
+	CodeUnauthorized         = -32001
+	CodeForbidden            = -32003
+	CodeNotFound             = -32004
+	CodeExpired              = -32005
+	CodeIncompatibleProtocol = -32010
+	CodeThrottled            = -32029
+)
+
+// Error is a JSON-RPC error object. Data holds machine readable details, e.g. when to retry.
+// Errors compare equal with errors.Is when their codes match, so callers can test for the
+// sentinel errors below.
+type Error struct {
+	Code    int            `json:"code"`
+	Message string         `json:"message"`
+	Data    map[string]any `json:"data,omitempty"`
+}
+
+var (
+	ErrServer               = &Error{Code: CodeServerError, Message: "internal server error"}
+	ErrUnauthorized         = &Error{Code: CodeUnauthorized, Message: "not authorized"}
+	ErrForbidden            = &Error{Code: CodeForbidden, Message: "access denied"}
+	ErrNotFound             = &Error{Code: CodeNotFound, Message: "not found"}
+	ErrExpired              = &Error{Code: CodeExpired, Message: "expired"}
+	ErrIncompatibleProtocol = &Error{Code: CodeIncompatibleProtocol, Message: "incompatible protocol version"}
+	ErrThrottled            = &Error{Code: CodeThrottled, Message: "too many requests"}
+)
+
+func NewError(code int, message string, data map[string]any) *Error {
+	return &Error{Code: code, Message: message, Data: data}
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s (code %d)", e.Message, e.Code)
+}
+
+func (e *Error) Is(target error) bool {
+	other, ok := target.(*Error)
+	return ok && other.Code == e.Code
+}
@@ -0,0 +1,32 @@
+package service
+
+// EventModuleChanged is emitted when the data synchronized by a module has changed.
+const EventModuleChanged = "module_changed"
+
+// HeaderUsername carries the username for requests authenticated with a bearer token.
+const HeaderUsername = "X-Lazysync-Username"
+
+type Event struct {
+	Type   string `json:"type"`
+	Module string `json:"module"`
+}
+
+// Progress event types, reported by clients while they synchronize.
+const (
+	ProgressModuleStarted  = "module_started"
+	ProgressModuleFinished = "module_finished" // Error is set when the module failed.
+	ProgressFileStarted    = "file_started"
+	ProgressFileSkipped    = "file_skipped" // The local copy is up to date.
+	ProgressFileFinished   = "file_finished"
+	ProgressFileFailed     = "file_failed"
+)
+
+// Progress reports a step of a synchronization to programs embedding the client.
+// Size is the size of finished files.
+type Progress struct {
+	Type   string
+	Module string
+	File   string
+	Size   int64
+	Error  error
+}
@@ -0,0 +1,30 @@
+package service
+
+const HealthStatusOk = "ok"
+
+const HealthStatusFail = "fail"
+
+// HealthReport is returned by the server health and readiness endpoints.
+type HealthReport struct {
+	Status string                 `json:"status"`
+	Checks map[string]HealthCheck `json:"checks,omitempty"`
+}
+
+type HealthCheck struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// NewHealthReport builds a report from check results, failing if any check failed.
+func NewHealthReport(results map[string]error) *HealthReport {
+	report := &HealthReport{Status: HealthStatusOk, Checks: map[string]HealthCheck{}}
+	for name, err := range results {
+		check := HealthCheck{Status: HealthStatusOk}
+		if err != nil {
+			check = HealthCheck{Status: HealthStatusFail, Error: err.Error()}
+			report.Status = HealthStatusFail
+		}
+		report.Checks[name] = check
+	}
+	return report
+}
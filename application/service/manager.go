@@ -5,46 +5,63 @@ import (
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/pem"
-	"io"
+	"errors"
 	"os"
+	"path/filepath"
+	"strings"
 )
 
 const KeyBasePath = "private/keys/"
 
 func ReadPublicKey(username string) *rsa.PublicKey {
-	path := KeyBasePath + username + "/key.rsa.pub"
-	file, err := os.Open(path)
+	key, err := LoadPublicKey(username)
 	if err != nil {
 		panic(err)
 	}
-	bytes, err := io.ReadAll(file)
+	return key
+}
+
+// LoadPublicKey reads the public key of the user, reporting unknown users and unreadable keys as errors.
+func LoadPublicKey(username string) (*rsa.PublicKey, error) {
+	return LoadPublicKeyFrom(KeyBasePath, username)
+}
+
+// LoadPublicKeyFrom reads the public key of the user from <directory>/<username>/key.rsa.pub.
+func LoadPublicKeyFrom(directory string, username string) (*rsa.PublicKey, error) {
+	if username == "" || strings.ContainsAny(username, `/\`) || strings.HasPrefix(username, ".") {
+		return nil, errors.New("invalid username")
+	}
+	path := filepath.Join(directory, username, "key.rsa.pub")
+	bytes, err := os.ReadFile(path)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 	block, _ := pem.Decode(bytes)
-	key, err := x509.ParsePKCS1PublicKey(block.Bytes)
-	if err != nil {
-		panic(err)
+	if block == nil {
+		return nil, errors.New("no PEM data found in " + path)
 	}
-	return key
+	return x509.ParsePKCS1PublicKey(block.Bytes)
 }
 
 func ReadPrivateKey(username string) *rsa.PrivateKey {
-	path := KeyBasePath + username + "/key.rsa"
-	file, err := os.Open(path)
+	key, err := LoadPrivateKey(KeyBasePath + username + "/key.rsa")
 	if err != nil {
 		panic(err)
 	}
-	bytes, err := io.ReadAll(file)
+	return key
+}
+
+// LoadPrivateKey reads a PEM encoded PKCS#1 private key, reporting unreadable keys as errors.
+func LoadPrivateKey(path string) (*rsa.PrivateKey, error) {
+	bytes, err := os.ReadFile(path)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 	block, _ := pem.Decode(bytes)
-	key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
-	if err != nil {
-		panic(err)
+	if block == nil {
+		return nil, errors.New("no PEM data found in " + path)
 	}
-	return key
+	return x509.ParsePKCS1PrivateKey(block.Bytes)
 }
 
 func GenerateRandomBytesSequence(n int) []byte {
@@ -0,0 +1,78 @@
+package service
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version of lazysync, set at build time with -ldflags "-X lazysync/application/service.Version=1.2.3".
+var Version = "dev"
+
+// ProtocolVersion is the wire format version as major.minor. Peers with the same major understand
+// each other, new minor versions only add optional fields and capabilities.
+const ProtocolVersion = "2.0"
+
+// LegacyProtocolVersion is assumed for servers older than the handshake.
+const LegacyProtocolVersion = "1.0"
+
+type HelloArgs struct {
+	ProtocolVersion string `json:"protocol_version"`
+	ClientVersion   string `json:"client_version"`
+}
+
+type HelloRequest struct {
+	Version string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  []HelloArgs `json:"params"`
+	Id      string      `json:"id"`
+}
+
+// HelloResponse describes the server: its versions and the capabilities of every enabled module.
+type HelloResponse struct {
+	ProtocolVersion string                    `json:"protocol_version"`
+	ServerVersion   string                    `json:"server_version"`
+	Modules         map[string]ModuleFeatures `json:"modules"`
+}
+
+type ModuleFeatures struct {
+	Capabilities []string `json:"capabilities"`
+}
+
+func NewHelloRequest() *HelloRequest {
+	request := new(HelloRequest)
+	request.Version = JSONRPCVersion
+	request.Method = "Server.Hello"
+	return request
+}
+
+// ModuleCapabilities returns the capabilities announced for a module, and false when the server
+// did not announce the module, e.g. because it predates the handshake.
+func (h *HelloResponse) ModuleCapabilities(module string) ([]string, bool) {
+	features, ok := h.Modules[module]
+	return features.Capabilities, ok
+}
+
+// CheckProtocol returns an error if a peer speaking the given protocol version cannot be understood.
+func CheckProtocol(version string) error {
+	major, err := protocolMajor(version)
+	if err != nil {
+		return err
+	}
+	own, _ := protocolMajor(ProtocolVersion)
+	if major != own {
+		return NewError(CodeIncompatibleProtocol,
+			fmt.Sprintf("incompatible protocol version %s, this version of lazysync speaks %s", version, ProtocolVersion),
+			map[string]any{"protocol_version": ProtocolVersion})
+	}
+	return nil
+}
+
+func protocolMajor(version string) (int, error) {
+	major, _, _ := strings.Cut(version, ".")
+	value, err := strconv.Atoi(major)
+	if err != nil {
+		return 0, fmt.Errorf("invalid protocol version %q", version)
+	}
+	return value, nil
+}
@@ -1,7 +1,60 @@
 package service
 
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// SyncObject is the state of a module sent by the server in reply to a synchronization request.
+// Every module declares its own type, the framework encodes and decodes it, and Validate is called
+// after decoding so malformed responses are reported instead of leaving zero values behind.
 type SyncObject interface {
-	ParseResponse(jsonResponse string)
+	Validate() error
 }
 
+// BaseSyncObject can be embedded by sync objects that need no validation.
 type BaseSyncObject struct{}
+
+func (BaseSyncObject) Validate() error {
+	return nil
+}
+
+// ErrInvalidSyncObject wraps every failure to decode a sync object.
+var ErrInvalidSyncObject = errors.New("invalid sync object")
+
+// EncodeSyncObject encodes the object returned by a module as JSON.
+func EncodeSyncObject(object SyncObject) (json.RawMessage, error) {
+	if object == nil {
+		return nil, errors.New("module returned no sync object")
+	}
+	return json.Marshal(object)
+}
+
+// DecodeSyncObject decodes the JSON data into object and validates it.
+func DecodeSyncObject(data json.RawMessage, object SyncObject) error {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || bytes.Equal(data, []byte("null")) {
+		return fmt.Errorf("%w: missing", ErrInvalidSyncObject)
+	}
+	err := json.Unmarshal(data, object)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidSyncObject, err)
+	}
+	err = object.Validate()
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidSyncObject, err)
+	}
+	return nil
+}
+
+// SyncObjectAs returns the object as the type declared by a module, failing instead of panicking
+// when it was handed an object of another type.
+func SyncObjectAs[T SyncObject](object SyncObject) (T, error) {
+	typed, ok := object.(T)
+	if !ok {
+		return typed, fmt.Errorf("%w: got %T, expected %T", ErrInvalidSyncObject, object, typed)
+	}
+	return typed, nil
+}
@@ -0,0 +1,75 @@
+package service
+
+import (
+	"errors"
+	"testing"
+)
+
+type testSyncObject struct {
+	Name  string   `json:"name"`
+	Files []string `json:"files"`
+}
+
+func (o *testSyncObject) Validate() error {
+	if o.Name == "" {
+		return errors.New("missing name")
+	}
+	return nil
+}
+
+func TestDecodeSyncObject(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    string // Name of the decoded object.
+		wantErr bool
+	}{
+		{"valid", `{"name": "app", "files": ["a.txt"]}`, "app", false},
+		{"surrounding space", " \n{\"name\": \"app\"}\n", "app", false},
+		{"unknown fields", `{"name": "app", "extra": 1}`, "app", false},
+		{"empty", ``, "", true},
+		{"blank", "  \n", "", true},
+		{"null", `null`, "", true},
+		{"malformed", `{"name": `, "", true},
+		{"wrong type", `{"name": 1}`, "", true},
+		{"not an object", `["app"]`, "", true},
+		{"invalid", `{"files": []}`, "", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			object := &testSyncObject{}
+			err := DecodeSyncObject([]byte(test.data), object)
+			if test.wantErr {
+				if !errors.Is(err, ErrInvalidSyncObject) {
+					t.Fatalf("DecodeSyncObject(%q) error = %v, want ErrInvalidSyncObject", test.data, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("DecodeSyncObject(%q): %v", test.data, err)
+			}
+			if object.Name != test.want {
+				t.Errorf("DecodeSyncObject(%q) name = %q, want %q", test.data, object.Name, test.want)
+			}
+		})
+	}
+}
+
+func TestEncodeSyncObjectRoundTrip(t *testing.T) {
+	data, err := EncodeSyncObject(&testSyncObject{Name: "app", Files: []string{"a.txt", "b/c.txt"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	object := &testSyncObject{}
+	err = DecodeSyncObject(data, object)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if object.Name != "app" || len(object.Files) != 2 || object.Files[1] != "b/c.txt" {
+		t.Errorf("round trip = %+v", object)
+	}
+	_, err = EncodeSyncObject(nil)
+	if err == nil {
+		t.Error("EncodeSyncObject(nil) succeeded, want an error")
+	}
+}
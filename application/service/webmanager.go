@@ -1,13 +1,17 @@
 package service
 
+import "encoding/json"
+
 const TokenTypeKey = "key"
 
 const TokenTypeJWT = "jwt"
 
+// Response is the JSON-RPC 2.0 response envelope, exactly one of Result and Error is set.
 type Response struct {
-	Result *BaseResponse `json:"result"`
-	Error  interface{}   `json:"error"`
-	ID     string        `json:"id"`
+	Version string          `json:"jsonrpc"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+	ID      string          `json:"id"`
 }
 
 type BaseResponse struct {
@@ -26,9 +30,10 @@ type AuthenticationArgs struct {
 }
 
 type AuthenticationRequest struct {
-	Method string               `json:"method"`
-	Params []AuthenticationArgs `json:"params"`
-	Id     string               `json:"id"`
+	Version string               `json:"jsonrpc"`
+	Method  string               `json:"method"`
+	Params  []AuthenticationArgs `json:"params"`
+	Id      string               `json:"id"`
 }
 
 type AuthenticationResponse struct {
@@ -51,24 +56,35 @@ type SynchronizationArgs struct {
 }
 
 type SynchronizationRequest struct {
-	Method string                `json:"method"`
-	Params []SynchronizationArgs `json:"params"`
-	Id     string                `json:"id"`
+	Version string                `json:"jsonrpc"`
+	Method  string                `json:"method"`
+	Params  []SynchronizationArgs `json:"params"`
+	Id      string                `json:"id"`
 }
 
+// SynchronizationResponse carries the encoded sync object of a module, see EncodeSyncObject.
 type SynchronizationResponse struct {
-	Status int         `json:"status"`
-	Object *SyncObject `json:"object"`
+	Status int             `json:"status"`
+	Object json.RawMessage `json:"object"`
 }
 
 func NewAuthenticationRequest() *AuthenticationRequest {
 	request := new(AuthenticationRequest)
+	request.Version = JSONRPCVersion
 	request.Method = "Server.Authorize"
 	return request
 }
 
+func NewLogoutRequest() *AuthenticationRequest {
+	request := new(AuthenticationRequest)
+	request.Version = JSONRPCVersion
+	request.Method = "Server.Logout"
+	return request
+}
+
 func NewSynchronizationRequest() *SynchronizationRequest {
 	request := new(SynchronizationRequest)
+	request.Version = JSONRPCVersion
 	request.Method = "Server.Synchronize"
 	return request
 }
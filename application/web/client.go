@@ -0,0 +1,145 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"io"
+	"lazysync/application/service"
+	"log/slog"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// StatusError is returned for responses with a status other than 2xx.
+type StatusError struct {
+	StatusCode int
+	Status     string
+	RetryAfter time.Duration // Delay requested by the server, zero when not given.
+}
+
+func (e *StatusError) Error() string {
+	return "unexpected response: " + e.Status
+}
+
+// Connection sends the requests of a client to its server. It holds the http clients, sharing a
+// connection pool, and the retry settings; every client has its own, so programs embedding several
+// clients may configure them differently.
+type Connection struct {
+	client   *http.Client // For requests, bounded by the overall timeout.
+	streams  *http.Client // For long lived streams and transfers, sharing the connection pool.
+	settings service.ConnectionConfiguration
+	// requestEncodings holds, per server host, the encoding the server announced for request bodies.
+	requestEncodings sync.Map
+}
+
+// NewConnection returns a connection using the settings, unset values fall back to their defaults.
+func NewConnection(settings service.ConnectionConfiguration) (*Connection, error) {
+	settings = settings.WithDefaults()
+	proxy, err := proxyFunc(settings.Proxy)
+	if err != nil {
+		return nil, err
+	}
+	transport := &http.Transport{
+		Proxy:                 proxy,
+		DialContext:           dialer(&net.Dialer{Timeout: settings.ConnectTimeout, KeepAlive: 30 * time.Second}),
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   16,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   settings.ConnectTimeout,
+		ExpectContinueTimeout: time.Second,
+	}
+	return &Connection{
+		client:   &http.Client{Transport: transport, Timeout: settings.Timeout},
+		streams:  &http.Client{Transport: transport},
+		settings: settings,
+	}, nil
+}
+
+// Settings returns the settings of the connection, with defaults applied.
+func (c *Connection) Settings() service.ConnectionConfiguration {
+	return c.settings
+}
+
+// Close closes the idle connections of the pool, requests in progress are not interrupted.
+func (c *Connection) Close() {
+	c.client.CloseIdleConnections()
+}
+
+// Retry runs an idempotent operation until it succeeds, fails with an error that is not worth
+// retrying, the configured retries are used up or ctx is cancelled.
+func (c *Connection) Retry(ctx context.Context, operation func(ctx context.Context) error) error {
+	settings := c.settings
+	for attempt := 0; ; attempt++ {
+		err := operation(ctx)
+		if err == nil || !IsRetryable(err) || attempt >= settings.Retries || ctx.Err() != nil {
+			return err
+		}
+		wait := retryDelay(settings, attempt, err)
+		slog.Debug("Retrying request", "attempt", attempt+1, "retry_in", wait.Round(time.Millisecond), "error", err)
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return errors.Join(err, ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
+
+// retryable is implemented by the errors of other transports, which know whether they are worth retrying.
+type retryable interface {
+	Retryable() bool
+}
+
+// IsRetryable reports whether a failed request may succeed when sent again:
+// network failures, interrupted transfers, server errors and rate limits.
+func IsRetryable(err error) bool {
+	if errors.Is(err, ErrTransferStalled) {
+		return true
+	}
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	var transportError retryable
+	if errors.As(err, &transportError) {
+		return transportError.Retryable()
+	}
+	var statusError *StatusError
+	if errors.As(err, &statusError) {
+		return statusError.StatusCode >= http.StatusInternalServerError || statusError.StatusCode == http.StatusTooManyRequests
+	}
+	var netError net.Error
+	return errors.As(err, &netError) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) ||
+		errors.Is(err, context.DeadlineExceeded)
+}
+
+// retryDelay doubles the delay on every attempt and spreads it by up to 50%, so clients failing
+// together do not retry together. A delay requested by the server takes precedence.
+func retryDelay(settings service.ConnectionConfiguration, attempt int, err error) time.Duration {
+	var statusError *StatusError
+	if errors.As(err, &statusError) && statusError.RetryAfter > 0 {
+		return min(statusError.RetryAfter, settings.MaxRetryDelay)
+	}
+	wait := settings.RetryDelay << attempt
+	if wait <= 0 || wait > settings.MaxRetryDelay {
+		wait = settings.MaxRetryDelay
+	}
+	return wait/2 + time.Duration(rand.Int63n(int64(wait/2)+1))
+}
+
+func checkStatus(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	statusError := &StatusError{StatusCode: resp.StatusCode, Status: resp.Status}
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		statusError.RetryAfter = time.Duration(seconds) * time.Second
+	}
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	resp.Body.Close()
+	return statusError
+}
@@ -2,15 +2,24 @@ package web
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"github.com/google/uuid"
 	"github.com/tidwall/gjson"
 	"io"
+	"lazysync/application/compression"
+	"lazysync/application/logging"
 	"lazysync/application/service"
+	"log/slog"
 	"net/http"
 )
 
-const DefaultUrl = "http://localhost:8080"
+const DefaultUrl = service.DefaultServerUrl
+
+// MaxResponseSize bounds the decoded body of compressed responses to JSON-RPC calls.
+const MaxResponseSize = 64 << 20
 
 const MethodGet = "GET"
 
@@ -24,76 +33,199 @@ type Request struct {
 	ID     string `json:"id,omitempty"`
 }
 
-func Login(username string, signature []byte) (*service.AuthenticationResponse, error) {
-	authentication := service.AuthenticationToken{Username: username, TokenType: service.TokenTypeKey, Token: signature}
-	connectionArguments := service.AuthenticationArgs{Token: &authentication}
-	authenticationRequest := service.NewAuthenticationRequest()
-	authenticationRequest.Params = append(authenticationRequest.Params, connectionArguments)
-	authenticationRequest.Id = "1"
-	jsonData, err := json.Marshal(authenticationRequest)
-	resp, err := SendJsonRequest(http.MethodPost, DefaultUrl, jsonData)
+// Hello performs the handshake. Servers predating it are reported with the legacy protocol
+// version, servers speaking the JSON-RPC 1.0 framing with the version they announce.
+func (c *Connection) Hello(ctx context.Context, serverUrl string) (*service.HelloResponse, error) {
+	request := service.NewHelloRequest()
+	request.Params = append(request.Params, service.HelloArgs{ProtocolVersion: service.ProtocolVersion, ClientVersion: service.Version})
+	request.Id = NewRequestID()
+	jsonData, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	var respBody []byte
+	err = c.Retry(ctx, func(ctx context.Context) error {
+		respBody, err = c.ReadJsonResponse(ctx, http.MethodPost, serverUrl, jsonData)
+		return err
+	})
+	var statusError *StatusError
+	if errors.As(err, &statusError) && statusError.StatusCode == http.StatusBadRequest {
+		// Servers predating the handshake answer unknown methods with a bad request.
+		return &service.HelloResponse{ProtocolVersion: service.LegacyProtocolVersion}, nil
+	}
 	if err != nil {
 		return nil, err
 	}
-	defer func(Body io.ReadCloser) {
-		err = Body.Close()
+	result := json.RawMessage(gjson.GetBytes(respBody, "result").Raw)
+	if !gjson.GetBytes(respBody, "jsonrpc").Exists() {
+		// Servers speaking JSON-RPC 1.0 report errors, like a rejected protocol version, as plain strings.
+		if legacyError := gjson.GetBytes(respBody, "error"); legacyError.Type == gjson.String {
+			return nil, service.NewError(service.CodeIncompatibleProtocol, legacyError.String(), nil)
+		}
+	} else {
+		result, err = ReadResult(respBody, request.Id)
 		if err != nil {
-			panic(err)
+			return nil, err
 		}
-	}(resp.Body)
+	}
+	response := new(service.HelloResponse)
+	err = json.Unmarshal(result, response)
+	if err != nil {
+		return nil, fmt.Errorf("invalid handshake response: %w", err)
+	}
+	return response, nil
+}
+
+func (c *Connection) Login(ctx context.Context, serverUrl string, username string, signature []byte) (*service.AuthenticationResponse, error) {
+	authentication := service.AuthenticationToken{Username: username, TokenType: service.TokenTypeKey, Token: signature}
+	return c.authenticate(ctx, serverUrl, service.NewAuthenticationRequest(), &authentication)
+}
+
+// Refresh exchanges a still valid JWT for a new one, extending the session without signing in again.
+func (c *Connection) Refresh(ctx context.Context, serverUrl string, username string, token string) (*service.AuthenticationResponse, error) {
+	authentication := service.AuthenticationToken{Username: username, TokenType: service.TokenTypeJWT, Token: []byte(token)}
+	return c.authenticate(ctx, serverUrl, service.NewAuthenticationRequest(), &authentication)
+}
+
+// Logout revokes the session on the server.
+func (c *Connection) Logout(ctx context.Context, serverUrl string, username string, token string) error {
+	authentication := service.AuthenticationToken{Username: username, TokenType: service.TokenTypeJWT, Token: []byte(token)}
+	response, err := c.authenticate(ctx, serverUrl, service.NewLogoutRequest(), &authentication)
+	if err != nil {
+		return err
+	}
+	if response.Status != http.StatusOK {
+		return errors.New("logout rejected")
+	}
+	return nil
+}
 
-	respBody, err := io.ReadAll(resp.Body)
+// authenticate sends an authentication request. It is not retried, every attempt counts against
+// the login limits of the server.
+func (c *Connection) authenticate(ctx context.Context, serverUrl string, authenticationRequest *service.AuthenticationRequest, authentication *service.AuthenticationToken) (*service.AuthenticationResponse, error) {
+	connectionArguments := service.AuthenticationArgs{Token: authentication}
+	authenticationRequest.Params = append(authenticationRequest.Params, connectionArguments)
+	authenticationRequest.Id = NewRequestID()
+	result, err := c.call(ctx, serverUrl, authenticationRequest, authenticationRequest.Id, false)
+	if err != nil {
+		return nil, err
+	}
 	response := &service.BaseResponse{
 		Status: 0,
 		Object: nil,
 	}
-	parseResult := gjson.Get(string(respBody), "result")
+	parseResult := gjson.ParseBytes(result)
 	response.Status = int(parseResult.Get("status").Int())
 	response.Object = parseResult.Get("token").String()
-	authResponse := service.NewAuthenticationResponse(response)
-	if err != nil {
-		return authResponse, err
-	}
-	return authResponse, nil
+	return service.NewAuthenticationResponse(response), nil
 }
 
-func Sync(username string, token string, module string, result service.SyncObject) (*service.SyncObject, error) {
+// Sync requests the state of a module, retrying on network and server failures, and decodes it into object.
+// Malformed objects are reported as service.ErrInvalidSyncObject.
+func (c *Connection) Sync(ctx context.Context, serverUrl string, username string, token string, module string, object service.SyncObject) error {
 	arguments := service.SynchronizationArgs{
 		Module: module,
 		Token:  &service.AuthenticationToken{Username: username, TokenType: service.TokenTypeJWT, Token: []byte(token)},
 	}
 	request := service.NewSynchronizationRequest()
 	request.Params = append(request.Params, arguments)
-	request.Id = "2"
-	jsonData, err := json.Marshal(request)
+	request.Id = NewRequestID()
+	result, err := c.call(ctx, serverUrl, request, request.Id, true)
 	if err != nil {
-		panic(err)
+		return err
 	}
-	resp, err := SendJsonRequest(http.MethodPost, DefaultUrl, jsonData)
+	var response service.SynchronizationResponse
+	err = json.Unmarshal(result, &response)
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("invalid synchronization response: %w", err)
 	}
-	respBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		panic(err)
-	}
-	parseResult := gjson.Get(string(respBody), "result")
-	status := int(parseResult.Get("status").Int())
-	objectResponse := parseResult.Get("object").String()
-	result.ParseResponse(objectResponse)
-	if status != http.StatusOK {
-		return &result, errors.New("request accepted")
+	if response.Status != http.StatusOK {
+		return fmt.Errorf("unexpected synchronization status %d", response.Status)
 	}
-	return &result, nil
+	return service.DecodeSyncObject(response.Object, object)
+}
+
+// SendJsonRequest posts the request, accepting compressed responses and compressing large request
+// bodies once the server announced it accepts them. The returned body is always decoded.
+// Responses with a status other than 2xx are returned as *StatusError.
+func (c *Connection) SendJsonRequest(ctx context.Context, method string, url string, jsonData []byte) (*http.Response, error) {
+	return c.send(ctx, c.client, method, url, jsonData, MaxResponseSize)
 }
 
-func SendJsonRequest(method string, url string, jsonData []byte) (*http.Response, error) {
-	req, err := http.NewRequest(method, url, bytes.NewBuffer(jsonData))
+// send posts the request with client, compressed response bodies decode to at most limit bytes.
+func (c *Connection) send(ctx context.Context, client *http.Client, method string, url string, jsonData []byte, limit int64) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
 	if err != nil {
 		return nil, err
 	}
+	body, encoding := jsonData, compression.Identity
+	if accepted, ok := c.requestEncodings.Load(req.URL.Host); ok {
+		body, encoding, err = compression.Compress(jsonData, accepted.(string))
+		if err != nil {
+			return nil, err
+		}
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
 	req.Header.Set("Content-Type", "application/json")
-	client := &http.Client{}
+	req.Header.Set("Accept-Encoding", compression.AcceptEncoding())
+	if encoding != compression.Identity {
+		req.Header.Set("Content-Encoding", encoding)
+	}
+	requestID := uuid.New().String()
+	req.Header.Set(logging.HeaderRequestID, requestID)
+	slog.Debug("Sending request", "url", url, "encoding", encoding, logging.KeyRequestID, requestID)
 	resp, err := client.Do(req)
-	return resp, err
+	if err != nil {
+		return nil, err
+	}
+	if accepted := resp.Header.Get("Accept-Encoding"); accepted != "" {
+		c.requestEncodings.Store(req.URL.Host, compression.Negotiate(accepted))
+	}
+	err = checkStatus(resp)
+	if err != nil {
+		return nil, err
+	}
+	return decodeResponse(resp, limit)
+}
+
+// ReadJsonResponse sends the request and reads the whole response body, so a transfer interrupted
+// midway surfaces as error of this call and can be retried as a whole.
+func (c *Connection) ReadJsonResponse(ctx context.Context, method string, url string, jsonData []byte) ([]byte, error) {
+	resp, err := c.SendJsonRequest(ctx, method, url, jsonData)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(resp.Body)
+}
+
+// decodeResponse replaces the body of a compressed response with its decoded contents, which
+// fail to read once they exceed limit bytes.
+func decodeResponse(resp *http.Response, limit int64) (*http.Response, error) {
+	encoding := resp.Header.Get("Content-Encoding")
+	if encoding == "" || encoding == compression.Identity {
+		return resp, nil
+	}
+	decoded, err := compression.NewReader(resp.Body, encoding, limit)
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	resp.Body = &decodedBody{ReadCloser: decoded, raw: resp.Body}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+	return resp, nil
+}
+
+type decodedBody struct {
+	io.ReadCloser
+	raw io.ReadCloser
+}
+
+func (b *decodedBody) Close() error {
+	_ = b.ReadCloser.Close()
+	return b.raw.Close()
 }
@@ -0,0 +1,64 @@
+package web
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"lazysync/application/logging"
+	"lazysync/application/service"
+	"net/http"
+	"strings"
+)
+
+const EventsPath = "/events"
+
+// Subscribe opens the server event stream and calls handle for every received event.
+// It blocks until the stream is closed by the server, fails, or ctx is cancelled.
+func (c *Connection) Subscribe(ctx context.Context, serverUrl string, username string, token string, handle func(event service.Event)) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, serverUrl+EventsPath, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set(service.HeaderUsername, username)
+	req.Header.Set(logging.HeaderRequestID, uuid.New().String())
+	resp, err := c.streams.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("event stream rejected: %s", resp.Status)
+	}
+	var data strings.Builder
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			// An empty line terminates the event.
+			if data.Len() == 0 {
+				continue
+			}
+			var event service.Event
+			err = json.Unmarshal([]byte(data.String()), &event)
+			data.Reset()
+			if err != nil {
+				continue
+			}
+			handle(event)
+		case strings.HasPrefix(line, "data:"):
+			data.WriteString(strings.TrimSpace(strings.TrimPrefix(line, "data:")))
+		}
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err = scanner.Err(); err != nil {
+		return err
+	}
+	return fmt.Errorf("event stream closed by server")
+}
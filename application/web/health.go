@@ -0,0 +1,39 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"lazysync/application/service"
+	"net/http"
+)
+
+const ReadinessPath = "/readyz"
+
+// CheckHealth asks the server for its readiness report. An unreachable server or an
+// unexpected answer is returned as error, a server that is up but not ready is not. The report
+// only lists the checks when a token of the user is given.
+func (c *Connection) CheckHealth(ctx context.Context, serverUrl string, username string, token string) (*service.HealthReport, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, serverUrl+ReadinessPath, nil)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set(service.HeaderUsername, username)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusServiceUnavailable {
+		return nil, fmt.Errorf("unexpected response: %s", resp.Status)
+	}
+	report := new(service.HealthReport)
+	err = json.NewDecoder(resp.Body).Decode(report)
+	if err != nil {
+		return nil, fmt.Errorf("invalid health report: %w", err)
+	}
+	return report, nil
+}
@@ -0,0 +1,57 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"lazysync/application/service"
+	"net/http"
+)
+
+// NewRequestID returns a unique JSON-RPC request id.
+func NewRequestID() string {
+	return uuid.New().String()
+}
+
+// ReadResult validates the JSON-RPC 2.0 response to the request with the given id and returns its
+// result. A failed call is returned as *service.Error, so callers can inspect its code and data.
+func ReadResult(body []byte, id string) (json.RawMessage, error) {
+	var response service.Response
+	err := json.Unmarshal(body, &response)
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON-RPC response: %w", err)
+	}
+	if response.Version != service.JSONRPCVersion {
+		return nil, fmt.Errorf("invalid JSON-RPC response: unsupported version %q", response.Version)
+	}
+	if response.Error != nil {
+		return nil, response.Error
+	}
+	if response.ID != id {
+		return nil, fmt.Errorf("invalid JSON-RPC response: id %q does not match request %q", response.ID, id)
+	}
+	return response.Result, nil
+}
+
+// call posts a JSON-RPC request and returns the result. Only idempotent calls may be retried.
+func (c *Connection) call(ctx context.Context, serverUrl string, request any, id string, retry bool) (json.RawMessage, error) {
+	jsonData, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	var respBody []byte
+	send := func(ctx context.Context) error {
+		respBody, err = c.ReadJsonResponse(ctx, http.MethodPost, serverUrl, jsonData)
+		return err
+	}
+	if retry {
+		err = c.Retry(ctx, send)
+	} else {
+		err = send(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ReadResult(respBody, id)
+}
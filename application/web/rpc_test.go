@@ -0,0 +1,54 @@
+package web
+
+import (
+	"errors"
+	"lazysync/application/service"
+	"testing"
+)
+
+func TestReadResult(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		want     string
+		wantCode int // Code of the expected *service.Error, 0 for other errors.
+		wantErr  bool
+	}{
+		{"result", `{"jsonrpc": "2.0", "id": "1", "result": {"status": 200}}`, `{"status": 200}`, 0, false},
+		{"null result", `{"jsonrpc": "2.0", "id": "1", "result": null}`, `null`, 0, false},
+		{"error", `{"jsonrpc": "2.0", "id": "1", "error": {"code": -32001, "message": "not authorized"}}`, "", service.CodeUnauthorized, true},
+		{"error with data", `{"jsonrpc": "2.0", "id": "1", "error": {"code": -32029, "message": "too many requests", "data": {"retry_after": 5}}}`, "", service.CodeThrottled, true},
+		// Errors of requests the server failed to parse carry no id.
+		{"error without id", `{"jsonrpc": "2.0", "id": null, "error": {"code": -32700, "message": "parse error"}}`, "", service.CodeParseError, true},
+		{"other id", `{"jsonrpc": "2.0", "id": "2", "result": {}}`, "", 0, true},
+		{"missing version", `{"id": "1", "result": {}}`, "", 0, true},
+		{"other version", `{"jsonrpc": "1.0", "id": "1", "result": {}}`, "", 0, true},
+		{"not json", `<html>Bad Gateway</html>`, "", 0, true},
+		{"empty", ``, "", 0, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := ReadResult([]byte(test.body), "1")
+			if !test.wantErr {
+				if err != nil {
+					t.Fatalf("ReadResult: %v", err)
+				}
+				if string(result) != test.want {
+					t.Errorf("ReadResult = %s, want %s", result, test.want)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("ReadResult = %s, want an error", result)
+			}
+			var serviceError *service.Error
+			isServiceError := errors.As(err, &serviceError)
+			if isServiceError != (test.wantCode != 0) {
+				t.Fatalf("ReadResult error = %#v, want code %d", err, test.wantCode)
+			}
+			if isServiceError && serviceError.Code != test.wantCode {
+				t.Errorf("ReadResult error code = %d, want %d", serviceError.Code, test.wantCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+)
+
+// ErrTransferStalled is returned when no data of a transfer arrived within the idle timeout.
+// Stalled transfers are retried.
+var ErrTransferStalled = errors.New("transfer stalled")
+
+// SendTransferRequest posts a request like SendJsonRequest does, for responses carrying file data.
+// Instead of the overall timeout of requests, it fails with ErrTransferStalled once waiting for the
+// response or reading its body made no progress for the idle timeout of the settings. Time spent
+// between reads, e.g. by bandwidth limits, does not count. Compressed bodies decode to at most
+// limit bytes. The body has to be closed.
+func (c *Connection) SendTransferRequest(ctx context.Context, method string, url string, jsonData []byte, limit int64) (*http.Response, error) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	timeout := c.settings.IdleTimeout
+	timer := time.AfterFunc(timeout, func() {
+		cancel(ErrTransferStalled)
+	})
+	resp, err := c.send(ctx, c.streams, method, url, jsonData, limit)
+	timer.Stop()
+	if err != nil {
+		err = stalledError(ctx, err)
+		cancel(nil)
+		return nil, err
+	}
+	resp.Body = &idleBody{ReadCloser: resp.Body, ctx: ctx, cancel: cancel, timer: timer, timeout: timeout}
+	return resp, nil
+}
+
+// idleBody cancels the request it belongs to when a single read waits longer than timeout.
+type idleBody struct {
+	io.ReadCloser
+	ctx     context.Context
+	cancel  context.CancelCauseFunc
+	timer   *time.Timer
+	timeout time.Duration
+}
+
+func (b *idleBody) Read(p []byte) (int, error) {
+	b.timer.Reset(b.timeout)
+	n, err := b.ReadCloser.Read(p)
+	b.timer.Stop()
+	if err != nil && !errors.Is(err, io.EOF) {
+		err = stalledError(b.ctx, err)
+	}
+	return n, err
+}
+
+func (b *idleBody) Close() error {
+	b.timer.Stop()
+	err := b.ReadCloser.Close()
+	b.cancel(nil)
+	return err
+}
+
+// stalledError reports ErrTransferStalled for requests cancelled by their idle timeout.
+func stalledError(ctx context.Context, err error) error {
+	if errors.Is(context.Cause(ctx), ErrTransferStalled) {
+		return ErrTransferStalled
+	}
+	return err
+}
@@ -0,0 +1,84 @@
+package web
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// unixScheme prefixes server urls of Unix domain sockets, e.g. unix:///run/lazysync.sock.
+const unixScheme = "unix://"
+
+// socketHostSuffix marks the hosts standing for a socket path, which is hex encoded in the host name.
+const socketHostSuffix = ".sock.lazysync"
+
+// ProxyDirect disables proxies, including the ones set in the environment.
+const ProxyDirect = "direct"
+
+// BaseUrl returns the url requests to the server are built from. Unix socket urls are turned into
+// http urls whose host stands for the socket, so paths can be appended as for any other server.
+func BaseUrl(serverUrl string) string {
+	path, ok := strings.CutPrefix(serverUrl, unixScheme)
+	if !ok {
+		return strings.TrimSuffix(serverUrl, "/")
+	}
+	return "http://" + hex.EncodeToString([]byte(path)) + socketHostSuffix
+}
+
+// socketPath returns the socket a host created by BaseUrl stands for.
+func socketPath(host string) (string, bool) {
+	encoded, ok := strings.CutSuffix(host, socketHostSuffix)
+	if !ok {
+		return "", false
+	}
+	path, err := hex.DecodeString(encoded)
+	if err != nil {
+		return "", false
+	}
+	return string(path), true
+}
+
+// dialer connects to Unix sockets for socket hosts and over TCP otherwise.
+func dialer(base *net.Dialer) func(ctx context.Context, network string, address string) (net.Conn, error) {
+	return func(ctx context.Context, network string, address string) (net.Conn, error) {
+		host, _, err := net.SplitHostPort(address)
+		if err == nil {
+			if path, ok := socketPath(host); ok {
+				return base.DialContext(ctx, "unix", path)
+			}
+		}
+		return base.DialContext(ctx, network, address)
+	}
+}
+
+// proxyFunc selects the proxy for requests: the configured one, none with ProxyDirect, or the
+// one from the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables when not configured.
+// Requests to Unix sockets never use a proxy.
+func proxyFunc(proxy string) (func(*http.Request) (*url.URL, error), error) {
+	selectProxy := http.ProxyFromEnvironment
+	switch proxy {
+	case "":
+	case ProxyDirect:
+		selectProxy = func(*http.Request) (*url.URL, error) { return nil, nil }
+	default:
+		proxyUrl, err := url.Parse(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy %q: %w", proxy, err)
+		}
+		if proxyUrl.Scheme == "" || proxyUrl.Host == "" {
+			return nil, errors.New("invalid proxy " + proxy + ", expected e.g. http://proxy.example.com:3128")
+		}
+		selectProxy = http.ProxyURL(proxyUrl)
+	}
+	return func(req *http.Request) (*url.URL, error) {
+		if _, ok := socketPath(req.URL.Hostname()); ok {
+			return nil, nil
+		}
+		return selectProxy(req)
+	}, nil
+}
@@ -0,0 +1,109 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"lazysync/application/audit"
+	"lazysync/application/service"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// auditCmd represents the audit command
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Shows the server audit log",
+	Long: `Shows authentication and synchronization events recorded by the server.
+Times accept RFC 3339 timestamps, dates (2006-01-02) or durations relative to now (24h).`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path, _ := cmd.Flags().GetString("file")
+		if path == "" {
+			configuration, err := service.ReadOptionalConfiguration()
+			if err != nil {
+				return err
+			}
+			path = configuration.Server.WithDefaults().AuditLog
+		}
+		filter := audit.Filter{}
+		filter.Username, _ = cmd.Flags().GetString("user")
+		filter.Types, _ = cmd.Flags().GetStringSlice("event")
+		for _, eventType := range filter.Types {
+			if !slices.Contains(audit.EventTypes, eventType) {
+				return errors.New("unknown event type " + eventType + ", expected one of: " + strings.Join(audit.EventTypes, ", "))
+			}
+		}
+		var err error
+		since, _ := cmd.Flags().GetString("since")
+		filter.Since, err = parseAuditTime(since)
+		if err != nil {
+			return err
+		}
+		until, _ := cmd.Flags().GetString("until")
+		filter.Until, err = parseAuditTime(until)
+		if err != nil {
+			return err
+		}
+		events, err := audit.Read(path, filter)
+		if err != nil {
+			return err
+		}
+		asJson, _ := cmd.Flags().GetBool("json")
+		if asJson {
+			encoder := json.NewEncoder(os.Stdout)
+			for _, event := range events {
+				_ = encoder.Encode(event)
+			}
+			return nil
+		}
+		writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(writer, "TIME\tEVENT\tUSER\tREMOTE\tMODULE\tFILE\tSIZE\tDETAILS")
+		for _, event := range events {
+			details := event.Error
+			if details == "" && event.Hash != "" {
+				details = "sha256:" + event.Hash
+			}
+			size := ""
+			if event.Size > 0 {
+				size = strconv.FormatInt(event.Size, 10)
+			}
+			fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", event.Time.Local().Format(time.DateTime),
+				event.Type, event.Username, event.RemoteAddr, event.Module, event.File, size, details)
+		}
+		return writer.Flush()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(auditCmd)
+	auditCmd.Flags().String("file", "", "Audit log to read (default the one configured for the server)")
+	auditCmd.Flags().StringP("user", "u", "", "Show events of the given user only")
+	auditCmd.Flags().StringSliceP("event", "e", nil, "Show events of the given type only, can be repeated")
+	auditCmd.Flags().String("since", "", "Show events recorded at or after the given time")
+	auditCmd.Flags().String("until", "", "Show events recorded at or before the given time")
+	auditCmd.Flags().Bool("json", false, "Print events as JSON lines")
+}
+
+func parseAuditTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if duration, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-duration), nil
+	}
+	for _, layout := range []string{time.RFC3339, time.DateTime, time.DateOnly} {
+		if parsed, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return parsed, nil
+		}
+	}
+	return time.Time{}, errors.New("invalid time: " + value)
+}
@@ -0,0 +1,87 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"lazysync/application/service"
+	"lazysync/modules"
+	"lazysync/modules/plugin"
+	"os"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// configCmd represents the config command
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Manages the configuration",
+}
+
+// configValidateCmd represents the config validate command
+var configValidateCmd = &cobra.Command{
+	Use:   "validate [file]",
+	Short: "Checks a configuration file",
+	Long: `Checks the settings of a configuration file and the config section of every enabled module,
+reporting each problem with its line. The file defaults to ` + service.ConfigFile + ` in the working directory.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path := service.ConfigFile
+		if len(args) > 0 {
+			path = args[0]
+		}
+		contents, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		cmd.SilenceUsage = true
+		plugins, err := pluginIds(contents)
+		if err != nil {
+			return err
+		}
+		configErrors := modules.ValidateConfiguration(contents, plugins)
+		if len(configErrors) == 0 {
+			fmt.Println(path, "is valid")
+			return nil
+		}
+		for _, configError := range configErrors {
+			location := path
+			if configError.Line > 0 {
+				location = fmt.Sprintf("%s:%d", path, configError.Line)
+			}
+			if configError.Field != "" {
+				location += ": " + configError.Field
+			}
+			fmt.Printf("%s: %s\n", location, configError.Message)
+		}
+		return fmt.Errorf("%s has %d error(s)", path, len(configErrors))
+	},
+}
+
+// pluginIds returns the modules provided by the plugins directory of the configuration, if any.
+// Contents failing to parse have none, ValidateConfiguration reports why.
+func pluginIds(contents []byte) ([]string, error) {
+	var configuration struct {
+		Plugins service.PluginConfiguration `yaml:"plugins"`
+	}
+	if yaml.Unmarshal(contents, &configuration) != nil || configuration.Plugins.Directory == "" {
+		return nil, nil
+	}
+	plugins, err := plugin.Discover(configuration.Plugins)
+	if err != nil {
+		return nil, errors.New("cannot load plugins: " + err.Error())
+	}
+	ids := make([]string, 0, len(plugins))
+	for _, module := range plugins {
+		ids = append(ids, module.GetId())
+	}
+	return ids, nil
+}
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configValidateCmd)
+}
@@ -4,6 +4,9 @@ Copyright © 2024 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
+	"lazysync/application/logging"
+	"lazysync/application/service"
+	"log/slog"
 	"os"
 
 	"github.com/spf13/cobra"
@@ -34,8 +37,29 @@ func init() {
 	// will be global for your application.
 
 	// rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.lazysync.yaml)")
+	rootCmd.PersistentFlags().String("log-level", "", "Log level: debug, info, warn or error (default from config, info)")
+	rootCmd.PersistentFlags().String("log-format", "", "Log format: text or json (default from config, text)")
 
 	// Cobra also supports local flags, which will only run
 	// when this action is called directly.
 	//rootCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
 }
+
+// newLogger creates the application logger, command line flags take precedence over the configuration.
+// The logger also becomes the default one, so packages without an injected logger use the same output.
+func newLogger(cmd *cobra.Command, configuration service.LogConfiguration) (*slog.Logger, error) {
+	level, _ := cmd.Flags().GetString("log-level")
+	if level == "" {
+		level = configuration.Level
+	}
+	format, _ := cmd.Flags().GetString("log-format")
+	if format == "" {
+		format = configuration.Format
+	}
+	logger, err := logging.New(os.Stderr, level, format)
+	if err != nil {
+		return nil, err
+	}
+	slog.SetDefault(logger)
+	return logger, nil
+}
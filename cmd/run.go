@@ -4,22 +4,50 @@ Copyright © 2024 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
+	"errors"
 	"lazysync/application"
+	"lazysync/application/bandwidth"
+	"lazysync/application/client"
+	"lazysync/application/service"
 
 	"github.com/spf13/cobra"
 )
 
+var maxRate bandwidth.Rate
+
 // runCmd represents the run command
 var runCmd = &cobra.Command{
 	Use:   "run",
 	Short: "Runs an application",
 	Long:  `Starts configured application in dedicated role`,
-	Run: func(cmd *cobra.Command, args []string) {
-		app := application.InitFromConfig()
+	RunE: func(cmd *cobra.Command, args []string) error {
+		configuration := service.LoadConfiguration()
+		logger, err := newLogger(cmd, configuration.Log)
+		if err != nil {
+			return err
+		}
+		app := application.InitFromConfiguration(configuration)
+		if app == nil {
+			return errors.New("unknown mode in configuration: " + configuration.Mode)
+		}
+		app.SetLogger(logger)
+		if c, ok := app.(*client.Client); ok {
+			c.Daemon, _ = cmd.Flags().GetBool("daemon")
+			c.Interval, _ = cmd.Flags().GetDuration("interval")
+			c.Modules, _ = cmd.Flags().GetStringSlice("module")
+			c.Workers, _ = cmd.Flags().GetInt("workers")
+			c.MaxRate = maxRate
+		}
 		app.Run()
+		return nil
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(runCmd)
+	runCmd.Flags().BoolP("daemon", "d", false, "Keep the client running and synchronize periodically")
+	runCmd.Flags().Duration("interval", client.DefaultInterval, "Time between synchronizations in daemon mode")
+	runCmd.Flags().StringSliceP("module", "m", nil, "Module to synchronize, can be repeated (default all enabled modules)")
+	runCmd.Flags().Int("workers", client.DefaultWorkers, "Parallel downloads per module")
+	runCmd.Flags().Var(&maxRate, "max-rate", "Download rate limit shared by all transfers, e.g. 500KB or 2MiB")
 }
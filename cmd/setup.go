@@ -12,6 +12,7 @@ import (
 	"lazysync/application/server"
 	"lazysync/application/service"
 	"lazysync/modules"
+	"lazysync/modules/plugin"
 	"os"
 )
 
@@ -21,9 +22,11 @@ var setupCmd = &cobra.Command{
 	Short: "Set up your application",
 	Long:  `Run application set up process`,
 	Run: func(cmd *cobra.Command, args []string) {
-		app := SetupApplication()
+		plugins := service.PluginConfiguration{}
+		plugins.Directory, _ = cmd.Flags().GetString("plugins")
+		app := SetupApplication(plugins)
 		fmt.Println("Selected mode: " + app.GetType())
-		module := setupModule()
+		module := setupModule(plugins)
 		if app.GetType() == server.Type {
 			module.SetupModule()
 			fmt.Println("Selected module: " + module.GetId())
@@ -35,6 +38,7 @@ var setupCmd = &cobra.Command{
 
 func init() {
 	rootCmd.AddCommand(setupCmd)
+	setupCmd.Flags().String("plugins", "", "Directory of module plugins to offer, it is saved in the configuration")
 }
 
 type configModel struct {
@@ -54,9 +58,9 @@ type modulesModel struct {
 	selectedModule string
 }
 
-func SetupApplication() application.App {
+func SetupApplication(plugins service.PluginConfiguration) application.App {
 	var app application.App
-	setup := tea.NewProgram(initialModel())
+	setup := tea.NewProgram(initialModel(plugins))
 	teaModel, err := setup.Run()
 	if err != nil {
 		fmt.Println("\n" + err.Error())
@@ -70,7 +74,7 @@ func SetupApplication() application.App {
 	return app
 }
 
-func initialModel() *configModel {
+func initialModel(plugins service.PluginConfiguration) *configModel {
 
 	return &configModel{
 		// Our to-do list is a grocery list
@@ -81,8 +85,8 @@ func initialModel() *configModel {
 		// of the `choices` slice, above.
 		//selected: make(map[int]struct{}),
 		selected: map[int]application.App{
-			0: &server.Server{Configuration: &service.AppConfiguration{}},
-			1: &client.Client{Configuration: &service.AppConfiguration{}},
+			0: &server.Server{Configuration: &service.AppConfiguration{Plugins: plugins}},
+			1: &client.Client{Configuration: &service.AppConfiguration{Plugins: plugins}},
 		},
 		quit: false,
 	}
@@ -158,8 +162,13 @@ func (m configModel) View() string {
 	return s
 }
 
-func setupModule() modules.Module {
-	setup := tea.NewProgram(moduleSelectModel())
+func setupModule(plugins service.PluginConfiguration) modules.Module {
+	model, err := moduleSelectModel(plugins)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+	setup := tea.NewProgram(model)
 	teaModel, err := setup.Run()
 	if err != nil {
 		fmt.Println("\n" + err.Error())
@@ -175,8 +184,12 @@ func setupModule() modules.Module {
 	return module
 }
 
-func moduleSelectModel() *modulesModel {
+func moduleSelectModel(plugins service.PluginConfiguration) (*modulesModel, error) {
 	modulesHandler := modules.InitModuleHandler()
+	err := plugin.Load(modulesHandler, plugins)
+	if err != nil {
+		return nil, err
+	}
 	return &modulesModel{
 		// Our to-do list is a grocery list
 		choices: modulesHandler.GetModuleNamesList(),
@@ -188,7 +201,7 @@ func moduleSelectModel() *modulesModel {
 		quit:           false,
 		moduleHandler:  modulesHandler,
 		selectedModule: "",
-	}
+	}, nil
 }
 
 func (m modulesModel) Init() tea.Cmd {
@@ -250,8 +263,12 @@ func (m modulesModel) View() string {
 			cursor = ">" // cursor!
 		}
 
-		// Render the row
-		s += fmt.Sprintf("%s %s\n", cursor, choice)
+		// Render the row, with the description of the module
+		s += fmt.Sprintf("%s %s", cursor, choice)
+		if metadata, ok := modules.Lookup(choice); ok && metadata.Description != "" {
+			s += fmt.Sprintf(" - %s (%s)", metadata.Description, metadata.Version)
+		}
+		s += "\n"
 	}
 
 	// The footer
@@ -0,0 +1,102 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"lazysync/application/client"
+	"lazysync/application/service"
+	"lazysync/application/web"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// statusCmd represents the status command
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Checks the configured server",
+	Long: `Reports whether the server configured for this client is reachable and ready.
+With --checks it signs in to list the result of every check, which starts a new session,
+clients running for the same user sign in again.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		configuration, err := service.ReadOptionalConfiguration()
+		if err != nil {
+			return err
+		}
+		timeout, _ := cmd.Flags().GetDuration("timeout")
+		serverUrl := configuration.GetServerUrl()
+		start := time.Now()
+		connection, err := web.NewConnection(configuration.Connection)
+		if err != nil {
+			return err
+		}
+		defer connection.Close()
+		ctx, cancel := context.WithTimeout(cmd.Context(), timeout)
+		defer cancel()
+		report, err := connection.CheckHealth(ctx, web.BaseUrl(serverUrl), "", "")
+		if err != nil {
+			fmt.Println("Server:", serverUrl)
+			fmt.Println("Status: unreachable")
+			cmd.SilenceUsage = true
+			return err
+		}
+		latency := time.Since(start)
+		if checks, _ := cmd.Flags().GetBool("checks"); checks {
+			report, err = signedInReport(ctx, configuration, connection)
+			if err != nil {
+				cmd.SilenceUsage = true
+				return fmt.Errorf("cannot list the checks: %w", err)
+			}
+		}
+		fmt.Println("Server:", serverUrl)
+		fmt.Println("Status:", report.Status)
+		fmt.Println("Latency:", latency.Round(time.Millisecond))
+		names := make([]string, 0, len(report.Checks))
+		for name := range report.Checks {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		for _, name := range names {
+			check := report.Checks[name]
+			line := fmt.Sprintf("  %-20s %s", name, check.Status)
+			if check.Error != "" {
+				line += ": " + check.Error
+			}
+			fmt.Println(line)
+		}
+		if report.Status != service.HealthStatusOk {
+			cmd.SilenceUsage = true
+			return errors.New("server is not ready")
+		}
+		return nil
+	},
+}
+
+// signedInReport signs in as the configured user to read the readiness report with the result of
+// every check, which the server only shows to signed in users.
+func signedInReport(ctx context.Context, configuration *service.AppConfiguration, connection *web.Connection) (*service.HealthReport, error) {
+	c := &client.Client{Configuration: configuration, Logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	err := c.Connect()
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+	err = c.Login(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return connection.CheckHealth(ctx, web.BaseUrl(configuration.GetServerUrl()), configuration.Username, c.JWTToken)
+}
+
+func init() {
+	rootCmd.AddCommand(statusCmd)
+	statusCmd.Flags().Duration("timeout", 5*time.Second, "Time to wait for the server to answer")
+	statusCmd.Flags().Bool("checks", false, "Sign in to list the result of every check")
+}
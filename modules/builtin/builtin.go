@@ -0,0 +1,9 @@
+// Package builtin registers the modules shipped with lazysync, it is imported for this side effect:
+//
+//	import _ "lazysync/modules/builtin"
+package builtin
+
+import (
+	_ "lazysync/modules/filesystem"
+	_ "lazysync/modules/updater"
+)
@@ -0,0 +1,122 @@
+package modules
+
+import (
+	"cmp"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"lazysync/application/service"
+	"reflect"
+	"slices"
+)
+
+// DecodeConfiguration decodes the config section of a registered module into a value of the type of
+// its ConfigSchema, rejecting unknown keys and invalid values, see service.DecodeModuleNode. The
+// config of modules without a schema, e.g. plugins, is returned unchanged.
+func DecodeConfiguration(id string, config any) (any, error) {
+	metadata, ok := Lookup(id)
+	if !ok || metadata.ConfigSchema == nil {
+		return config, nil
+	}
+	target := reflect.New(reflect.TypeOf(metadata.ConfigSchema))
+	err := service.DecodeModuleConfiguration(config, target.Interface())
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration of module %s: %w", id, err)
+	}
+	return target.Elem().Interface(), nil
+}
+
+// ValidateConfiguration checks the contents of a configuration file: its settings and the config
+// section of every enabled module, including the ones of groups. Modules must be registered or
+// named in plugins. The errors are sorted by line.
+func ValidateConfiguration(contents []byte, plugins []string) []*service.ConfigError {
+	var document yaml.Node
+	err := yaml.Unmarshal(contents, &document)
+	if err != nil {
+		return service.ConfigErrors(err)
+	}
+	if len(document.Content) == 0 {
+		return nil
+	}
+	root := document.Content[0]
+	var configuration service.AppConfiguration
+	configErrors := service.ConfigErrors(service.DecodeNode(root, &configuration))
+	validator := configValidator{plugins: plugins}
+	validator.checkModule(root, "", "module", "config")
+	for i, module := range sequence(value(root, "modules")) {
+		validator.checkModule(module, fmt.Sprintf("modules[%d].", i), "id", "config")
+	}
+	for i, group := range sequence(value(root, "groups")) {
+		for j, module := range sequence(value(group, "modules")) {
+			validator.checkModule(module, fmt.Sprintf("groups[%d].modules[%d].", i, j), "id", "config")
+		}
+	}
+	configErrors = append(configErrors, validator.errors...)
+	slices.SortStableFunc(configErrors, func(a, b *service.ConfigError) int {
+		return cmp.Compare(a.Line, b.Line)
+	})
+	return configErrors
+}
+
+type configValidator struct {
+	plugins []string
+	errors  []*service.ConfigError
+}
+
+// checkModule checks the module named by the idKey of mapping and its config section under configKey.
+func (v *configValidator) checkModule(mapping *yaml.Node, path string, idKey string, configKey string) {
+	id := value(mapping, idKey)
+	if id == nil || id.Kind != yaml.ScalarNode || id.Value == "" {
+		return
+	}
+	metadata, registered := Lookup(id.Value)
+	if !registered {
+		if !slices.Contains(v.plugins, id.Value) {
+			v.add(id.Line, path+idKey, "unknown module "+id.Value)
+		}
+		return
+	}
+	config := value(mapping, configKey)
+	if metadata.ConfigSchema == nil {
+		return
+	}
+	line := id.Line
+	if config == nil {
+		config = &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null"}
+	} else {
+		line = config.Line
+	}
+	target := reflect.New(reflect.TypeOf(metadata.ConfigSchema)).Interface()
+	for _, configError := range service.ConfigErrors(service.DecodeModuleNode(config, target)) {
+		if configError.Line == 0 {
+			// Errors of Validate carry no line, report them at the config section.
+			configError.Line = line
+		}
+		configError.Field = path + configKey
+		v.errors = append(v.errors, configError)
+	}
+}
+
+func (v *configValidator) add(line int, field string, message string) {
+	v.errors = append(v.errors, &service.ConfigError{Line: line, Field: field, Message: message})
+}
+
+// value returns the value of key in a mapping node, nil when absent.
+func value(mapping *yaml.Node, key string) *yaml.Node {
+	if mapping == nil || mapping.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// sequence returns the items of a sequence node, none for other nodes.
+func sequence(node *yaml.Node) []*yaml.Node {
+	if node == nil || node.Kind != yaml.SequenceNode {
+		return nil
+	}
+	return node.Content
+}
@@ -0,0 +1,190 @@
+package modules
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const testModuleID = "config-test"
+
+type testConfig struct {
+	Path  string `yaml:"path"`
+	Count int    `yaml:"count,omitempty"`
+}
+
+func (c *testConfig) Validate() error {
+	if c.Path == "" {
+		return errors.New("missing path")
+	}
+	return nil
+}
+
+func init() {
+	Register(Metadata{ID: testModuleID, ConfigSchema: testConfig{}}, func() Module {
+		return nil
+	})
+}
+
+func TestValidateConfiguration(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		plugins []string
+		want    []string // Prefixes of the errors, in order.
+	}{
+		{
+			name: "valid",
+			yaml: `mode: server
+modules:
+  - id: config-test
+    config:
+      path: /srv
+`,
+		},
+		{
+			name: "empty",
+			yaml: ``,
+		},
+		{
+			name: "syntax error",
+			yaml: `mode: server
+modules: [
+`,
+			want: []string{"line 2: did not find expected node content"},
+		},
+		{
+			name: "unknown setting",
+			yaml: `mode: server
+username: alice
+colour: red
+`,
+			want: []string{"line 3: field colour not found"},
+		},
+		{
+			name: "invalid value",
+			yaml: `mode: server
+server:
+  read_timeout: soon
+`,
+			want: []string{"line 3: cannot unmarshal"},
+		},
+		{
+			name: "unknown module",
+			yaml: `mode: server
+modules:
+  - id: inventory
+`,
+			want: []string{"line 3: modules[0].id: unknown module inventory"},
+		},
+		{
+			name: "plugin",
+			yaml: `mode: server
+modules:
+  - id: inventory
+    config:
+      anything: goes
+`,
+			plugins: []string{"inventory"},
+		},
+		{
+			name: "unknown module setting",
+			yaml: `mode: server
+modules:
+  - id: config-test
+    config:
+      path: /srv
+      colour: red
+`,
+			want: []string{"line 6: modules[0].config: field colour not found"},
+		},
+		{
+			name: "invalid module value",
+			yaml: `mode: server
+modules:
+  - id: config-test
+    config:
+      path: /srv
+      count: many
+`,
+			want: []string{"line 6: modules[0].config: cannot unmarshal"},
+		},
+		{
+			name: "validation error at the config section",
+			yaml: `mode: server
+modules:
+  - id: config-test
+    config:
+      count: 2
+`,
+			want: []string{"line 5: modules[0].config: missing path"},
+		},
+		{
+			name: "validation error without config section",
+			yaml: `mode: server
+modules:
+  - id: config-test
+`,
+			want: []string{"line 3: modules[0].config: missing path"},
+		},
+		{
+			name: "single module layout",
+			yaml: `mode: client
+module: config-test
+config:
+  count: 2
+`,
+			want: []string{"line 4: config: missing path"},
+		},
+		{
+			name: "group module",
+			yaml: `mode: server
+groups:
+  - name: web
+    users: [alice]
+    modules:
+      - id: config-test
+        config:
+          path: /srv
+      - id: config-test
+        config:
+          colour: red
+`,
+			want: []string{"line 11: groups[0].modules[1].config: field colour not found"},
+		},
+		{
+			name: "sorted by line",
+			yaml: `mode: server
+modules:
+  - id: config-test
+    config:
+      colour: red
+      path: /srv
+  - id: inventory
+colour: red
+`,
+			want: []string{
+				"line 5: modules[0].config: field colour not found",
+				"line 7: modules[1].id: unknown module inventory",
+				"line 8: field colour not found",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			configErrors := ValidateConfiguration([]byte(test.yaml), test.plugins)
+			var got []string
+			for _, configError := range configErrors {
+				got = append(got, configError.Error())
+			}
+			if len(got) != len(test.want) {
+				t.Fatalf("ValidateConfiguration = %q, want %q", got, test.want)
+			}
+			for i := range got {
+				if !strings.HasPrefix(got[i], test.want[i]) {
+					t.Errorf("error %d = %q, want prefix %q", i, got[i], test.want[i])
+				}
+			}
+		})
+	}
+}
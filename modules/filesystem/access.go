@@ -0,0 +1,106 @@
+package filesystem
+
+import (
+	"fmt"
+	"github.com/google/uuid"
+	"gopkg.in/yaml.v3"
+	"lazysync/application/service"
+	"time"
+)
+
+// ticketLifetime limits how long the download link handed out by Sync stays usable.
+const ticketLifetime = time.Hour
+
+// downloadTicket remembers who requested a synchronization, so downloads can be checked against the access lists.
+type downloadTicket struct {
+	principal *service.Principal
+	expiresAt time.Time
+}
+
+func (e *FileEntry) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		return node.Decode(&e.Path)
+	}
+	type plain FileEntry
+	err := node.Decode((*plain)(e))
+	if err != nil {
+		return err
+	}
+	err = service.KnownFields(node, e)
+	if err != nil {
+		return err
+	}
+	switch e.Compress {
+	case "", CompressAuto, CompressAlways, CompressNever:
+		return nil
+	}
+	message := fmt.Sprintf("line %d: invalid compress value %q for %s, expected auto, always or never", node.Line, e.Compress, e.Path)
+	return &yaml.TypeError{Errors: []string{message}}
+}
+
+func (e FileEntry) MarshalYAML() (interface{}, error) {
+	if len(e.Read) == 0 && e.Compress == "" {
+		return e.Path, nil
+	}
+	type plain FileEntry
+	return plain(e), nil
+}
+
+func (e *FileEntry) CanRead(principal *service.Principal) bool {
+	return len(e.Read) == 0 || principal.Matches(e.Read)
+}
+
+// permittedManifest returns the manifest entries the principal may read.
+// A file is readable if any of the global or group entries it belongs to grants access. When
+// readable files share a path, e.g. equally named directories of different groups, the first one
+// is served.
+func (f *FileSync) permittedManifest(manifest []FileManifestEntry, principal *service.Principal) []FileManifestEntry {
+	entries := f.entriesFor(principal)
+	var permitted []FileManifestEntry
+	paths := map[string]bool{}
+	for _, entry := range manifest {
+		if paths[entry.Path] {
+			continue
+		}
+		readable := false
+		for _, configured := range entries {
+			if configured.Path != entry.Source {
+				continue
+			}
+			if configured.CanRead(principal) {
+				readable = true
+				break
+			}
+		}
+		if readable {
+			permitted = append(permitted, entry)
+			paths[entry.Path] = true
+		}
+	}
+	return permitted
+}
+
+func (f *FileSync) issueTicket(principal *service.Principal) string {
+	actionId := uuid.New().String()
+	now := time.Now()
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	for id, ticket := range f.tickets {
+		if now.After(ticket.expiresAt) {
+			delete(f.tickets, id)
+		}
+	}
+	f.tickets[actionId] = &downloadTicket{principal: principal, expiresAt: now.Add(ticketLifetime)}
+	return actionId
+}
+
+// ticketPrincipal returns the principal a still valid download ticket was issued to.
+func (f *FileSync) ticketPrincipal(actionId string) *service.Principal {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	ticket, ok := f.tickets[actionId]
+	if !ok || time.Now().After(ticket.expiresAt) {
+		return nil
+	}
+	return ticket.principal
+}
@@ -0,0 +1,121 @@
+package filesystem
+
+import (
+	"gopkg.in/yaml.v3"
+	"lazysync/application/service"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestFileEntryCanRead(t *testing.T) {
+	alice := &service.Principal{Username: "alice", Groups: []string{"web"}}
+	tests := []struct {
+		name      string
+		read      []string
+		principal *service.Principal
+		want      bool
+	}{
+		{"unrestricted", nil, alice, true},
+		{"everyone", []string{"*"}, alice, true},
+		{"user", []string{"bob", "alice"}, alice, true},
+		{"other user", []string{"bob"}, alice, false},
+		{"group", []string{"@web"}, alice, true},
+		{"other group", []string{"@ops"}, alice, false},
+		{"group named like the user", []string{"@alice"}, alice, false},
+		{"user named like the group", []string{"web"}, alice, false},
+		{"no groups", []string{"@web"}, &service.Principal{Username: "bob"}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			entry := &FileEntry{Path: "/srv/app.conf", Read: test.read}
+			if got := entry.CanRead(test.principal); got != test.want {
+				t.Errorf("CanRead(%+v) with read %v = %v, want %v", test.principal, test.read, got, test.want)
+			}
+		})
+	}
+}
+
+func TestFileEntryUnmarshalYAML(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		want    FileEntry
+		wantErr string
+	}{
+		{"path only", `/srv/app.conf`, FileEntry{Path: "/srv/app.conf"}, ""},
+		{"read list", "path: /srv/app.conf\nread: [alice, \"@ops\"]", FileEntry{Path: "/srv/app.conf", Read: []string{"alice", "@ops"}}, ""},
+		{"compress", "path: /srv/app.conf\ncompress: never", FileEntry{Path: "/srv/app.conf", Compress: CompressNever}, ""},
+		{"write list", "path: /srv/app.conf\nread: [alice]\nwrite: [alice]", FileEntry{}, "line 3: field write not found"},
+		{"unknown key", "path: /srv/app.conf\nowner: alice", FileEntry{}, "line 2: field owner not found"},
+		{"invalid compress", "path: /srv/app.conf\ncompress: sometimes", FileEntry{}, `invalid compress value "sometimes"`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var entry FileEntry
+			err := yaml.Unmarshal([]byte(test.yaml), &entry)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("Unmarshal error = %v, want %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unmarshal: %v", err)
+			}
+			if entry.Path != test.want.Path || !slices.Equal(entry.Read, test.want.Read) || entry.Compress != test.want.Compress {
+				t.Errorf("Unmarshal = %+v, want %+v", entry, test.want)
+			}
+		})
+	}
+}
+
+func TestPermittedManifest(t *testing.T) {
+	f := &FileSync{
+		Configuration: FileSyncConfig{Files: []FileEntry{
+			{Path: "/srv/public"},
+			{Path: "/srv/secret.key", Read: []string{"@ops", "carol"}},
+			{Path: "/srv/shared/app.conf", Read: []string{"alice"}},
+		}},
+		groups: map[string][]FileEntry{
+			"web": {{Path: "/srv/web/app.conf"}, {Path: "/srv/web/site", Read: []string{"*"}}},
+			"ops": {{Path: "/srv/ops/tools", Read: []string{"bob"}}},
+		},
+	}
+	manifest := []FileManifestEntry{
+		{Path: "public/index.html", Source: "/srv/public"},
+		{Path: "secret.key", Source: "/srv/secret.key"},
+		{Path: "app.conf", Source: "/srv/shared/app.conf"},
+		{Path: "app.conf", Source: "/srv/web/app.conf"},
+		{Path: "site/index.html", Source: "/srv/web/site"},
+		{Path: "tools/deploy.sh", Source: "/srv/ops/tools"},
+	}
+	tests := []struct {
+		name      string
+		principal *service.Principal
+		want      []string // Sources of the permitted entries.
+	}{
+		{"no groups", &service.Principal{Username: "dave"}, []string{"/srv/public"}},
+		{"user listed", &service.Principal{Username: "carol"}, []string{"/srv/public", "/srv/secret.key"}},
+		{"group entries", &service.Principal{Username: "erin", Groups: []string{"web"}},
+			[]string{"/srv/public", "/srv/web/app.conf", "/srv/web/site"}},
+		{"first of equal paths", &service.Principal{Username: "alice", Groups: []string{"web"}},
+			[]string{"/srv/public", "/srv/shared/app.conf", "/srv/web/site"}},
+		{"group entry restricted to a member", &service.Principal{Username: "bob", Groups: []string{"ops"}},
+			[]string{"/srv/public", "/srv/secret.key", "/srv/ops/tools"}},
+		{"group entry of another member", &service.Principal{Username: "frank", Groups: []string{"ops"}},
+			[]string{"/srv/public", "/srv/secret.key"}},
+		{"entries of other groups", &service.Principal{Username: "bob"}, []string{"/srv/public"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var got []string
+			for _, entry := range f.permittedManifest(manifest, test.principal) {
+				got = append(got, entry.Source)
+			}
+			if !slices.Equal(got, test.want) {
+				t.Errorf("permittedManifest(%+v) = %v, want %v", test.principal, got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package filesystem
+
+import (
+	"lazysync/application/compression"
+	"lazysync/application/service"
+	"slices"
+)
+
+// CapabilityCompression tells clients the server compresses downloads with an encoding they offer.
+const CapabilityCompression = "compression"
+
+// CompressAuto compresses files unless their type shows they already are compressed.
+const CompressAuto = "auto"
+
+const CompressAlways = "always"
+
+const CompressNever = "never"
+
+// SetServerCapabilities stops offering encodings to servers that do not announce compression.
+func (f *FileSync) SetServerCapabilities(capabilities []string) {
+	f.encodings = nil
+	if slices.Contains(capabilities, CapabilityCompression) {
+		f.encodings = compression.Supported
+	}
+}
+
+// contentEncoding picks the compression of a served file from the encodings offered by the client.
+// The first entry readable by the principal with an explicit compress setting decides.
+func (f *FileSync) contentEncoding(entry FileManifestEntry, principal *service.Principal, contents []byte, offered []string) string {
+	mode := CompressAuto
+	for _, configured := range f.entriesFor(principal) {
+		if configured.Path == entry.Source && configured.CanRead(principal) && configured.Compress != "" {
+			mode = configured.Compress
+			break
+		}
+	}
+	switch mode {
+	case CompressNever:
+		return compression.Identity
+	case CompressAlways:
+		return compression.Choose(offered)
+	}
+	if compression.IsCompressed(entry.Name, contents[:min(len(contents), 512)]) {
+		return compression.Identity
+	}
+	return compression.Choose(offered)
+}
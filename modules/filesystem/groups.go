@@ -0,0 +1,63 @@
+package filesystem
+
+import (
+	"lazysync/application/service"
+	"slices"
+)
+
+// SetGroupConfiguration adds the files configured for a group, they are served to its members only.
+func (f *FileSync) SetGroupConfiguration(group string, configuration interface{}) error {
+	config, err := decodeConfiguration(configuration)
+	if err != nil {
+		return err
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.groups == nil {
+		f.groups = map[string][]FileEntry{}
+	}
+	f.groups[group] = append(f.groups[group], config.Files...)
+	return nil
+}
+
+// entriesFor returns the global entries followed by the entries of every group the principal belongs to.
+func (f *FileSync) entriesFor(principal *service.Principal) []FileEntry {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	entries := slices.Clone(f.Configuration.Files)
+	for _, group := range principal.Groups {
+		entries = append(entries, f.groups[group]...)
+	}
+	return entries
+}
+
+// allEntries returns the global and group entries, each path listed once, in a stable order.
+func (f *FileSync) allEntries() []FileEntry {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	entries := slices.Clone(f.Configuration.Files)
+	groups := make([]string, 0, len(f.groups))
+	for group := range f.groups {
+		groups = append(groups, group)
+	}
+	slices.Sort(groups)
+	for _, group := range groups {
+		entries = append(entries, f.groups[group]...)
+	}
+	seen := map[string]bool{}
+	return slices.DeleteFunc(entries, func(entry FileEntry) bool {
+		duplicate := seen[entry.Path]
+		seen[entry.Path] = true
+		return duplicate
+	})
+}
+
+// watchedPaths returns the path of every entry served to anyone.
+func (f *FileSync) watchedPaths() []string {
+	entries := f.allEntries()
+	paths := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		paths = append(paths, entry.Path)
+	}
+	return paths
+}
@@ -0,0 +1,329 @@
+package filesystem
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"google.golang.org/grpc"
+	"io"
+	"lazysync/application/bandwidth"
+	"lazysync/application/compression"
+	"lazysync/application/grpcapi"
+	"lazysync/application/web"
+	"log/slog"
+)
+
+const grpcServiceName = "lazysync.v1.FileSync"
+
+// chunkSize is the amount of file data sent in a single message of a download stream.
+const chunkSize = 64 * 1024
+
+type DownloadRequest struct {
+	Ticket    string
+	FileName  string
+	Encodings []string
+}
+
+// FileChunk is a part of a streamed file. The first chunk also carries the name, the encoding of
+// the stream and the length of the file once decoded.
+type FileChunk struct {
+	FileName string
+	Encoding string
+	Length   int64
+	Data     []byte
+}
+
+func (m *DownloadRequest) MarshalProto() []byte {
+	var e grpcapi.Encoder
+	e.String(1, m.Ticket)
+	e.String(2, m.FileName)
+	e.Strings(3, m.Encodings)
+	return e.Encoded()
+}
+
+func (m *DownloadRequest) UnmarshalProto(data []byte) error {
+	return grpcapi.Decode(data, func(field grpcapi.Field) error {
+		switch field.Number {
+		case 1:
+			m.Ticket = field.String()
+		case 2:
+			m.FileName = field.String()
+		case 3:
+			m.Encodings = append(m.Encodings, field.String())
+		}
+		return nil
+	})
+}
+
+func (m *FileChunk) MarshalProto() []byte {
+	var e grpcapi.Encoder
+	e.String(1, m.FileName)
+	e.String(2, m.Encoding)
+	e.Int(3, m.Length)
+	e.Bytes(4, m.Data)
+	return e.Encoded()
+}
+
+func (m *FileChunk) UnmarshalProto(data []byte) error {
+	return grpcapi.Decode(data, func(field grpcapi.Field) error {
+		switch field.Number {
+		case 1:
+			m.FileName = field.String()
+		case 2:
+			m.Encoding = field.String()
+		case 3:
+			m.Length = field.Int()
+		case 4:
+			m.Data = field.Bytes()
+		}
+		return nil
+	})
+}
+
+// PayloadSize is the file data carried by the chunk, counted by bandwidth limits.
+func (m *FileChunk) PayloadSize() int {
+	return len(m.Data)
+}
+
+// fileSyncService is the handler type of the FileSync gRPC service.
+type fileSyncService interface {
+	streamDownload(stream grpc.ServerStream) error
+}
+
+var downloadStreamDesc = grpc.StreamDesc{
+	StreamName:    "Download",
+	ServerStreams: true,
+}
+
+func (f *FileSync) RegisterGRPCService(registrar grpc.ServiceRegistrar) {
+	desc := downloadStreamDesc
+	desc.Handler = func(srv any, stream grpc.ServerStream) error {
+		return srv.(fileSyncService).streamDownload(stream)
+	}
+	registrar.RegisterService(&grpc.ServiceDesc{
+		ServiceName: grpcServiceName,
+		HandlerType: (*fileSyncService)(nil),
+		Streams:     []grpc.StreamDesc{desc},
+		Metadata:    "lazysync.proto",
+	}, f)
+}
+
+func (f *FileSync) SetGRPCConnection(conn grpc.ClientConnInterface) {
+	f.grpcConn = conn
+}
+
+// streamDownload serves a download like HandleDownload does, reading the file and compressing it
+// while it is sent in chunks.
+func (f *FileSync) streamDownload(stream grpc.ServerStream) error {
+	request := new(DownloadRequest)
+	err := stream.RecvMsg(request)
+	if err != nil {
+		return err
+	}
+	ctx := stream.Context()
+	file, entry, principal, err := f.openFile(request.Ticket, request.FileName)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	// Only the size found when opening the file is sent, clients check they received all of it.
+	size := info.Size()
+	head := make([]byte, min(size, compression.MinSize))
+	_, err = io.ReadFull(file, head)
+	if err != nil {
+		return err
+	}
+	encoding := compression.Identity
+	if size >= compression.MinSize {
+		encoding = f.contentEncoding(entry, principal, head, request.Encodings)
+	}
+	hash := sha256.New()
+	contents := io.TeeReader(io.MultiReader(bytes.NewReader(head), io.LimitReader(file, size-int64(len(head)))), hash)
+	sender := &chunkSender{stream: stream, header: &FileChunk{FileName: request.FileName, Encoding: encoding, Length: size}}
+	var output io.WriteCloser = sender
+	if encoding != compression.Identity {
+		output, err = compression.NewWriter(sender, encoding)
+		if err != nil {
+			return err
+		}
+	}
+	sent, err := io.Copy(output, contents)
+	if err == nil && sent < size {
+		err = fmt.Errorf("%s shrank while being sent: %w", entry.Path, io.ErrUnexpectedEOF)
+	}
+	if err != nil {
+		return err
+	}
+	err = output.Close()
+	if err == nil && output != sender {
+		err = sender.Close()
+	}
+	if err != nil {
+		return err
+	}
+	f.recordServed(ctx, grpcapi.RemoteAddr(ctx), principal, entry, size, hash.Sum(nil), encoding, sender.sent)
+	return nil
+}
+
+// chunkSender sends the data written to it in chunks of chunkSize bytes, the first chunk carrying
+// header. Close sends the remaining data, or the header alone for empty files.
+type chunkSender struct {
+	stream grpc.ServerStream
+	header *FileChunk
+	buffer []byte
+	sent   int64
+}
+
+func (s *chunkSender) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := min(len(p), chunkSize-len(s.buffer))
+		s.buffer = append(s.buffer, p[:n]...)
+		p = p[n:]
+		written += n
+		if len(s.buffer) == chunkSize {
+			err := s.flush()
+			if err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+func (s *chunkSender) Close() error {
+	if s.header == nil && len(s.buffer) == 0 {
+		return nil
+	}
+	return s.flush()
+}
+
+func (s *chunkSender) flush() error {
+	chunk := s.header
+	if chunk == nil {
+		chunk = &FileChunk{}
+	}
+	chunk.Data = s.buffer
+	// SendMsg encodes the chunk before it returns, the buffer can be reused.
+	err := s.stream.SendMsg(chunk)
+	if err != nil {
+		return err
+	}
+	s.sent += int64(len(s.buffer))
+	s.buffer = s.buffer[:0]
+	s.header = nil
+	return nil
+}
+
+// StreamDownload fetches a single file to destination over gRPC, the counterpart of DoDownload. The
+// file is decoded while it is received and replaces destination once it arrived in full.
+func StreamDownload(ctx context.Context, logger *slog.Logger, connection *web.Connection, limiter *bandwidth.Limiter, encodings []string, conn grpc.ClientConnInterface, ticket string, filepath string, destination string, limit int64) error {
+	fileName := remoteName(filepath)
+	logger.Info("Downloading", "file", fileName, "destination", destination, "transport", "grpc")
+	request := &DownloadRequest{Ticket: ticket, FileName: fileName, Encodings: encodings}
+	err := connection.Retry(ctx, func(ctx context.Context) error {
+		return replaceFile(destination, func(output io.Writer) error {
+			return receiveFile(ctx, limiter, conn, request, output, limit)
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("error while downloading %s: %w", fileName, err)
+	}
+	logger.Info("Downloaded", "file", fileName)
+	return nil
+}
+
+// receiveFile writes the file of a download stream to output, decoded to at most limit bytes.
+func receiveFile(ctx context.Context, limiter *bandwidth.Limiter, conn grpc.ClientConnInterface, request *DownloadRequest, output io.Writer, limit int64) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := conn.NewStream(ctx, &downloadStreamDesc, "/"+grpcServiceName+"/Download")
+	if err != nil {
+		return grpcapi.FromStatus(err, nil)
+	}
+	err = stream.SendMsg(request)
+	if err == nil {
+		err = stream.CloseSend()
+	}
+	if err != nil && !errors.Is(err, io.EOF) {
+		return grpcapi.FromStatus(err, nil)
+	}
+	chunks := &chunkReader{ctx: ctx, stream: stream, limiter: limiter}
+	header, err := chunks.next()
+	if errors.Is(err, io.EOF) {
+		return fmt.Errorf("%w: no data received", io.ErrUnexpectedEOF)
+	}
+	if err != nil {
+		return err
+	}
+	if header.Length > limit {
+		return compression.ErrTooLarge
+	}
+	var contents io.Reader = chunks
+	if header.Encoding != compression.Identity && header.Encoding != "" {
+		decoder, err := compression.NewReader(chunks, header.Encoding, limit)
+		if err != nil {
+			return err
+		}
+		defer decoder.Close()
+		contents = decoder
+	}
+	// Reading one byte more than announced detects streams longer than the file.
+	received, err := io.Copy(output, io.LimitReader(contents, header.Length+1))
+	if err != nil {
+		return err
+	}
+	if received != header.Length {
+		return fmt.Errorf("%w: received %d of %d bytes", io.ErrUnexpectedEOF, received, header.Length)
+	}
+	// The stream only succeeded once the status of the server arrived.
+	trailing, err := io.Copy(io.Discard, chunks)
+	if err == nil && trailing > 0 {
+		err = fmt.Errorf("received %d bytes after the end of the file", trailing)
+	}
+	return err
+}
+
+// chunkReader reads the data of the chunks of a download stream, no faster than the limiter allows.
+type chunkReader struct {
+	ctx     context.Context
+	stream  grpc.ClientStream
+	limiter *bandwidth.Limiter
+	data    []byte
+}
+
+// next receives the next chunk, io.EOF once the stream ended successfully.
+func (r *chunkReader) next() (*FileChunk, error) {
+	chunk := new(FileChunk)
+	err := r.stream.RecvMsg(chunk)
+	if errors.Is(err, io.EOF) {
+		return nil, io.EOF
+	}
+	if err != nil {
+		return nil, grpcapi.FromStatus(err, r.stream.Trailer())
+	}
+	err = bandwidth.Wait(r.ctx, len(chunk.Data), r.limiter)
+	if err != nil {
+		return nil, err
+	}
+	r.data = chunk.Data
+	return chunk, nil
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for len(r.data) == 0 {
+		_, err := r.next()
+		if err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
@@ -0,0 +1,44 @@
+package filesystem
+
+import (
+	"bytes"
+	"encoding/base64"
+	"lazysync/application/grpcapi"
+	"lazysync/application/grpcapi/prototest"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestMessagesMatchProto(t *testing.T) {
+	tests := []struct {
+		name    string
+		message grpcapi.Message
+		json    string
+	}{
+		{"DownloadRequest", &DownloadRequest{Ticket: "ticket", FileName: "conf/app.yml", Encodings: []string{"zstd", "gzip"}},
+			`{"ticket": "ticket", "filename": "conf/app.yml", "encodings": ["zstd", "gzip"]}`},
+		{"FileChunk", &FileChunk{FileName: "conf/app.yml", Encoding: "zstd", Length: 1 << 40, Data: []byte("data")},
+			`{"filename": "conf/app.yml", "encoding": "zstd", "length": "1099511627776", "data": "ZGF0YQ=="}`},
+		{"FileChunk", &FileChunk{Data: bytes.Repeat([]byte{0, 0xff}, chunkSize/2)},
+			`{"data": "` + base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{0, 0xff}, chunkSize/2)) + `"}`},
+		{"FileChunk", &FileChunk{Length: -1}, `{"length": "-1"}`},
+	}
+	file := prototest.Compile(t, "lazysync.proto", "../../application/grpcapi")
+	var tested []string
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			prototest.CheckMessage(t, file, test.name, test.message, test.json)
+		})
+		if slices.Contains(tested, test.name) {
+			continue
+		}
+		// Values equal to the defaults of proto3 are not sent.
+		t.Run(test.name+"/empty", func(t *testing.T) {
+			empty := reflect.New(reflect.TypeOf(test.message).Elem()).Interface().(grpcapi.Message)
+			prototest.CheckMessage(t, file, test.name, empty, `{}`)
+		})
+		tested = append(tested, test.name)
+	}
+	prototest.CheckService(t, file, "FileSync", tested)
+}
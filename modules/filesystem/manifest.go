@@ -0,0 +1,105 @@
+package filesystem
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// CapabilityManifest tells clients the sync object carries a manifest with file hashes.
+const CapabilityManifest = "manifest"
+
+// FileManifestEntry describes a single file served by the module. Path identifies the file: the
+// name of a configured file, or the path of a file within a configured directory relative to the
+// parent of the directory, e.g. conf/app/config.yml for /etc/conf/app/config.yml when /etc/conf
+// is configured. Paths use forward slashes, clients recreate them below their destination.
+type FileManifestEntry struct {
+	Name    string    `json:"name"`
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	Hash    string    `json:"hash"`
+	File    string    `json:"-"` // Location of the file on the server.
+	Source  string    `json:"-"` // Configured entry the file belongs to.
+}
+
+// buildManifest lists every configured file, expanding directories recursively.
+// Entries that cannot be read are skipped, they show up again once they become readable.
+func buildManifest(entries []FileEntry) []FileManifestEntry {
+	var manifest []FileManifestEntry
+	for _, configured := range entries {
+		root := filepath.Clean(configured.Path)
+		info, err := os.Stat(root)
+		if err != nil {
+			continue
+		}
+		if !info.IsDir() {
+			entry, err := newManifestEntry(root, filepath.Base(root), info)
+			if err == nil {
+				entry.Source = configured.Path
+				manifest = append(manifest, entry)
+			}
+			continue
+		}
+		_ = filepath.WalkDir(root, func(file string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil || !info.Mode().IsRegular() {
+				return nil
+			}
+			relative, err := filepath.Rel(filepath.Dir(root), file)
+			if err != nil {
+				return nil
+			}
+			entry, err := newManifestEntry(file, filepath.ToSlash(relative), info)
+			if err == nil {
+				entry.Source = configured.Path
+				manifest = append(manifest, entry)
+			}
+			return nil
+		})
+	}
+	return manifest
+}
+
+func newManifestEntry(file string, path string, info fs.FileInfo) (FileManifestEntry, error) {
+	hash, err := hashFile(file)
+	if err != nil {
+		return FileManifestEntry{}, err
+	}
+	return FileManifestEntry{
+		Name:    filepath.Base(file),
+		Path:    path,
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+		Hash:    hash,
+		File:    file,
+	}, nil
+}
+
+func hashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	_, err = io.Copy(hash, file)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func manifestsEqual(a []FileManifestEntry, b []FileManifestEntry) bool {
+	return slices.EqualFunc(a, b, func(x FileManifestEntry, y FileManifestEntry) bool {
+		return x.Path == y.Path && x.File == y.File && x.Source == y.Source && x.Size == y.Size && x.Hash == y.Hash && x.ModTime.Equal(y.ModTime)
+	})
+}
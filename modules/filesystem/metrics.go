@@ -0,0 +1,35 @@
+package filesystem
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func (f *FileSync) RegisterMetrics(registerer prometheus.Registerer) error {
+	revision := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: "lazysync",
+		Subsystem: ID,
+		Name:      "revision",
+		Help:      "Revision of the served files, bumped on every change.",
+	}, func() float64 {
+		f.lock.RLock()
+		defer f.lock.RUnlock()
+		return float64(f.revision)
+	})
+	files := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: "lazysync",
+		Subsystem: ID,
+		Name:      "manifest_files",
+		Help:      "Files listed in the cached manifest.",
+	}, func() float64 {
+		f.lock.RLock()
+		defer f.lock.RUnlock()
+		return float64(len(f.manifest))
+	})
+	for _, collector := range []prometheus.Collector{revision, files} {
+		err := registerer.Register(collector)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
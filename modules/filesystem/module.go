@@ -1,61 +1,152 @@
 package filesystem
 
 import (
-	"bytes"
+	"context"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"github.com/google/uuid"
 	"github.com/gorilla/mux"
-	"github.com/gorilla/rpc"
+	"github.com/gorilla/rpc/v2"
 	"github.com/tidwall/gjson"
+	"google.golang.org/grpc"
 	"io"
+	"lazysync/application/audit"
+	"lazysync/application/bandwidth"
+	"lazysync/application/compression"
+	"lazysync/application/logging"
 	"lazysync/application/service"
 	"lazysync/application/web"
+	"lazysync/modules"
 	"lazysync/modules/filesystem/cmd"
-	"log"
+	"log/slog"
 	"net/http"
+	"net/url"
 	"os"
+	"path"
+	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
 )
 
 const ID = "filesystem"
 
+const Version = "1.0.0"
+
 const port = ":3000"
 
 const host = "localhost"
 
+// maxFileSize bounds the size of downloaded files when the server announced none.
+const maxFileSize = 16 << 30
+
+// defaultWorkers is the amount of parallel downloads when the client did not set one.
+const defaultWorkers = 4
+
+var errFileNotFound = service.NewError(service.CodeNotFound, "requested file not found", nil)
+
 type FileSync struct {
 	id            string
 	Configuration FileSyncConfig
+	lock          sync.RWMutex
+	manifest      []FileManifestEntry
+	revision      uint64
+	listeners     []func()
+	watching      bool
+	stop          chan struct{}
+	workers       sync.WaitGroup
+	tickets       map[string]*downloadTicket
+	groups        map[string][]FileEntry
+	audit         *audit.Log
+	logger        *slog.Logger
+	serverUrl     string
+	connection    *web.Connection // Connection of the client, requests are sent with.
+	downloads     int
+	rateLimiter   *bandwidth.Limiter
+	encodings     []string // Encodings offered for downloads.
+	grpcConn      grpc.ClientConnInterface
+	progress      func(service.Progress)
+	destination   string // Directory downloads are written to, the working directory when empty.
 }
 
 type FileSyncConfig struct {
-	Files []string // Files list.
+	Files []FileEntry `yaml:"files"`           // Files list.
+	Watch string      `yaml:"watch,omitempty"` // Change detection: notify (default), poll or off.
 }
 
+func (c *FileSyncConfig) SetDefaults() {
+	if c.Watch == "" {
+		c.Watch = WatchModeNotify
+	}
+}
+
+func (c *FileSyncConfig) Validate() error {
+	switch c.Watch {
+	case WatchModeNotify, WatchModePoll, WatchModeOff:
+	default:
+		return fmt.Errorf("invalid watch mode %q, expected notify, poll or off", c.Watch)
+	}
+	for i, entry := range c.Files {
+		if entry.Path == "" {
+			return fmt.Errorf("files[%d]: missing path", i)
+		}
+	}
+	return nil
+}
+
+// FileEntry is a served file or directory. Read lists the users and "@groups" allowed to access it;
+// an entry without a read list is readable by everyone allowed to use the module.
+// In the config an entry is either a plain path or a mapping with path, read and compress keys.
+type FileEntry struct {
+	Path     string   `yaml:"path"`
+	Read     []string `yaml:"read,omitempty"`
+	Compress string   `yaml:"compress,omitempty"` // auto (default), always or never.
+}
+
+// FileSyncObject lists the files a client downloads. DownloadPath is the path of the downloads,
+// resolved by clients against the server url they are configured with. DownloadUrl is the same
+// path below the default server url, for clients before DownloadPath.
 type FileSyncObject struct {
-	DownloadUrl string
-	Files       []string
+	DownloadUrl  string
+	DownloadPath string
+	Files        []string
+	Revision     uint64
+	Manifest     []FileManifestEntry
 }
 
-type FileSyncArgs struct{}
+type FileSyncArgs struct {
+	Encodings []string `json:"encodings,omitempty"` // Encodings the client can decode.
+}
 
 type FileSyncRequest struct {
-	Method string         `json:"method"`
-	Params []FileSyncArgs `json:"params"`
-	Id     string         `json:"id"`
+	Version string         `json:"jsonrpc"`
+	Method  string         `json:"method"`
+	Params  []FileSyncArgs `json:"params"`
+	Id      string         `json:"id"`
 }
 
 type FileSyncResponse struct {
 	FileName     string `json:"filename"`
 	FileContents string `json:"contents"`
+	Encoding     string `json:"encoding,omitempty"` // Compression of the contents, empty when sent as is.
+}
+
+func init() {
+	modules.Register(modules.Metadata{
+		ID:           ID,
+		Description:  "Synchronizes files from the server to clients",
+		Version:      Version,
+		ConfigSchema: FileSyncConfig{},
+	}, func() modules.Module {
+		return Init()
+	})
 }
 
 func Init() *FileSync {
-	return &FileSync{id: ID, Configuration: FileSyncConfig{}}
+	return &FileSync{id: ID, Configuration: FileSyncConfig{}, tickets: map[string]*downloadTicket{}, encodings: compression.Supported}
 }
 
 func (f *FileSync) GetId() string {
@@ -63,129 +154,445 @@ func (f *FileSync) GetId() string {
 }
 
 func (f *FileSync) SetupModule() {
-	f.Configuration.Files = cmd.Setup()
+	for _, path := range cmd.Setup() {
+		f.Configuration.Files = append(f.Configuration.Files, FileEntry{Path: path})
+	}
+}
+
+func (f *FileSync) SetAuditLog(log *audit.Log) {
+	f.audit = log
+}
+
+func (f *FileSync) SetLogger(logger *slog.Logger) {
+	f.logger = logger
+}
+
+func (f *FileSync) SetServerUrl(serverUrl string) {
+	f.serverUrl = serverUrl
+}
+
+func (f *FileSync) Capabilities() []string {
+	return []string{CapabilityManifest, CapabilityCompression}
+}
+
+func (f *FileSync) SetProgress(report func(progress service.Progress)) {
+	f.progress = report
+}
+
+func (f *FileSync) SetDestination(directory string) {
+	f.destination = directory
+}
+
+// report passes a progress event to the client, if it listens.
+func (f *FileSync) report(progress service.Progress) {
+	if f.progress != nil {
+		f.progress(progress)
+	}
+}
+
+// localPath returns where a file announced by the server is stored by the client, recreating the
+// directories of its path below the destination.
+func (f *FileSync) localPath(file string) string {
+	return filepath.Join(f.destination, filepath.FromSlash(remoteName(file)))
+}
+
+// remoteName returns the name a file announced by the server is requested by. Servers before
+// relative paths announce the location of their files and serve them by base name.
+func remoteName(file string) string {
+	if path.IsAbs(file) || filepath.IsAbs(file) {
+		return path.Base(filepath.ToSlash(file))
+	}
+	return file
+}
+
+func (f *FileSync) SetConnection(connection *web.Connection) {
+	f.connection = connection
+}
+
+func (f *FileSync) SetTransferLimits(workers int, limiter *bandwidth.Limiter) {
+	f.downloads = workers
+	f.rateLimiter = limiter
+}
+
+// resolveUrl returns the url files of the sync object are downloaded from. The download path is
+// resolved against the configured server url, servers without it only send a full url.
+func (f *FileSync) resolveUrl(object *FileSyncObject) string {
+	if object.DownloadPath == "" {
+		return object.DownloadUrl
+	}
+	serverUrl := f.serverUrl
+	if serverUrl == "" {
+		serverUrl = web.DefaultUrl
+	}
+	return serverUrl + object.DownloadPath
+}
+
+func (f *FileSync) log() *slog.Logger {
+	if f.logger == nil {
+		return slog.Default()
+	}
+	return f.logger
 }
 
 func (f *FileSync) GetConfigurationValues() interface{} {
 	return f.Configuration
 }
 
-func (f *FileSync) SetConfiguration(configuration interface{}) {
-	var filelist []string
-	for _, value := range configuration.(map[string]interface{}) {
-		for _, filename := range value.([]interface{}) {
-			filelist = append(filelist, filename.(string))
-		}
+// SetConfiguration takes the config section decoded by modules.DecodeConfiguration, or any value
+// decoding into a valid FileSyncConfig.
+func (f *FileSync) SetConfiguration(configuration interface{}) error {
+	config, err := decodeConfiguration(configuration)
+	if err != nil {
+		return err
+	}
+	f.Configuration = config
+	return nil
+}
+
+func decodeConfiguration(configuration interface{}) (FileSyncConfig, error) {
+	if config, ok := configuration.(FileSyncConfig); ok {
+		return config, nil
 	}
-	f.Configuration.Files = filelist
+	var config FileSyncConfig
+	err := service.DecodeModuleConfiguration(configuration, &config)
+	return config, err
 }
 
-func (f *FileSync) Sync() service.SyncObject {
-	actionId := uuid.New().String()
+func (f *FileSync) Sync(principal *service.Principal) service.SyncObject {
+	actionId := f.issueTicket(principal)
 	path := "/download/" + actionId
-	fullUrl := web.DefaultUrl + path
+	manifest, revision := f.currentManifest()
+	manifest = f.permittedManifest(manifest, principal)
+	files := make([]string, 0, len(manifest))
+	for _, entry := range manifest {
+		files = append(files, entry.Path)
+	}
 	syncResponse := FileSyncObject{
-		DownloadUrl: fullUrl,
-		Files:       f.Configuration.Files,
+		DownloadUrl:  web.DefaultUrl + path,
+		DownloadPath: path,
+		Files:        files,
+		Revision:     revision,
+		Manifest:     manifest,
 	}
 	return &syncResponse
 }
 
-func (f *FileSync) ExecuteCommands(object service.SyncObject) {
-	fileSyncObject := object.(*FileSyncObject)
+func (f *FileSync) ExecuteCommands(ctx context.Context, object service.SyncObject) error {
+	fileSyncObject, err := service.SyncObjectAs[*FileSyncObject](object)
+	if err != nil {
+		return err
+	}
+	downloadUrl := f.resolveUrl(fileSyncObject)
+	manifest := map[string]FileManifestEntry{}
+	for _, entry := range fileSyncObject.Manifest {
+		manifest[entry.Path] = entry
+	}
+	workers := f.downloads
+	if workers <= 0 {
+		workers = defaultWorkers
+	}
+	workers = min(workers, len(fileSyncObject.Files))
+	errs := make([]error, len(fileSyncObject.Files))
+	queue := make(chan int)
 	var wg sync.WaitGroup
-	wg.Add(len(fileSyncObject.Files))
-	for _, file := range fileSyncObject.Files {
-		go DoDownload(fileSyncObject.DownloadUrl, file, &wg)
+	wg.Add(workers)
+	for range workers {
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				file := fileSyncObject.Files[i]
+				destination := f.localPath(file)
+				entry, announced := manifest[file]
+				if isUpToDate(destination, entry.Hash) {
+					f.log().Info("Up to date", "file", remoteName(file))
+					f.report(service.Progress{Type: service.ProgressFileSkipped, File: destination})
+					continue
+				}
+				f.report(service.Progress{Type: service.ProgressFileStarted, File: destination})
+				errs[i] = f.download(ctx, downloadUrl, file, destination, sizeLimit(entry.Size, announced))
+				if errs[i] != nil {
+					f.report(service.Progress{Type: service.ProgressFileFailed, File: destination, Error: errs[i]})
+					continue
+				}
+				finished := service.Progress{Type: service.ProgressFileFinished, File: destination}
+				if info, err := os.Stat(destination); err == nil {
+					finished.Size = info.Size()
+				}
+				f.report(finished)
+			}
+		}()
+	}
+	// Files not handed to a worker before ctx is cancelled are not downloaded. Workers still write
+	// errs, the cancellation is only added once they are done.
+	var cancelled error
+queue:
+	for i := range fileSyncObject.Files {
+		select {
+		case queue <- i:
+		case <-ctx.Done():
+			cancelled = ctx.Err()
+			break queue
+		}
 	}
+	close(queue)
 	wg.Wait()
+	return errors.Join(append(errs, cancelled)...)
+}
+
+// download fetches a file over gRPC when the client uses it, over JSON-RPC otherwise.
+func (f *FileSync) download(ctx context.Context, downloadUrl string, file string, destination string, limit int64) error {
+	if f.grpcConn != nil {
+		return StreamDownload(ctx, f.log(), f.connection, f.rateLimiter, f.encodings, f.grpcConn, path.Base(downloadUrl), file, destination, limit)
+	}
+	return DoDownload(ctx, f.log(), f.connection, f.rateLimiter, f.encodings, downloadUrl, file, destination, limit)
+}
+
+// sizeLimit bounds the decoded size of a download, leaving room for files growing between the
+// synchronization and the download. Files of servers without manifest are bounded by maxFileSize.
+func sizeLimit(size int64, announced bool) int64 {
+	if !announced {
+		return maxFileSize
+	}
+	return 2*size + 1<<20
+}
+
+// isUpToDate reports whether the local copy of a file already matches the hash announced by the server.
+func isUpToDate(localPath string, hash string) bool {
+	if hash == "" {
+		return false
+	}
+	localHash, err := hashFile(localPath)
+	return err == nil && localHash == hash
 }
 
 func (f *FileSync) GetSyncObjectInstance() service.SyncObject {
 	return new(FileSyncObject)
 }
 
-func (f *FileSyncObject) ParseResponse(jsonResponse string) {
-	f.DownloadUrl = gjson.Get(jsonResponse, "DownloadUrl").String()
-	files := gjson.Get(jsonResponse, "Files").Array()
-	for _, file := range files {
-		f.Files = append(f.Files, file.String())
+// Validate rejects objects a client cannot download from: a missing download url, unnamed files,
+// relative paths leaving the destination and manifest entries without a path or with a malformed hash.
+func (f *FileSyncObject) Validate() error {
+	if f.DownloadUrl == "" && f.DownloadPath == "" {
+		return errors.New("missing download url")
+	}
+	if f.DownloadPath != "" && !strings.HasPrefix(f.DownloadPath, "/") {
+		return fmt.Errorf("download path %s is not absolute", f.DownloadPath)
 	}
+	for i, file := range f.Files {
+		if file == "" {
+			return fmt.Errorf("file %d has no name", i)
+		}
+		if !filepath.IsLocal(filepath.FromSlash(remoteName(file))) {
+			return fmt.Errorf("file %s is outside of the destination", file)
+		}
+	}
+	for i, entry := range f.Manifest {
+		if entry.Path == "" {
+			return fmt.Errorf("manifest entry %d has no path", i)
+		}
+		if _, err := hex.DecodeString(entry.Hash); err != nil {
+			return fmt.Errorf("manifest entry %s has a malformed hash", entry.Path)
+		}
+	}
+	return nil
 }
 
-func DoDownload(downloadUrl string, filepath string, wg *sync.WaitGroup) {
-	defer wg.Done()
-	tokens := strings.Split(filepath, "/")
-	fileName := tokens[len(tokens)-1]
-	fmt.Println("Downloading", fileName, "to", fileName)
-	output, err := os.Create(fileName)
-	if err != nil {
-		log.Fatal("Error while creating", fileName, "-", err)
-	}
-	defer output.Close()
-	arguments := FileSyncArgs{}
+// DoDownload fetches a single file to destination with the connection, receiving no faster than the
+// limiter allows, which may be nil, and offering the server the given encodings. Files decoding to
+// more than limit bytes are rejected. Failed transfers are retried, the local file is only written
+// once the contents were received in full.
+func DoDownload(ctx context.Context, logger *slog.Logger, connection *web.Connection, limiter *bandwidth.Limiter, encodings []string, downloadUrl string, filepath string, destination string, limit int64) error {
+	fileName := remoteName(filepath)
+	logger.Info("Downloading", "file", fileName, "destination", destination)
+	arguments := FileSyncArgs{Encodings: encodings}
 	request := newDownloadFilesRequest()
 	request.Params = append(request.Params, arguments)
-	request.Id = "3"
+	request.Id = web.NewRequestID()
 	jsonData, err := json.Marshal(request)
 	if err != nil {
-		panic(err)
+		return err
 	}
-	fullUrl := downloadUrl + "/" + fileName
-	resp, err := web.SendJsonRequest(http.MethodPost, fullUrl, jsonData)
+	fullUrl := downloadUrl + "/" + escapePath(fileName)
+	// The contents are base64 encoded within the JSON-RPC response.
+	responseLimit := (limit+2)/3*4 + 1<<16
+	var responseBody []byte
+	err = connection.Retry(ctx, func(ctx context.Context) error {
+		resp, err := connection.SendTransferRequest(ctx, http.MethodPost, fullUrl, jsonData, responseLimit)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		responseBody, err = io.ReadAll(bandwidth.Reader(ctx, resp.Body, limiter))
+		return err
+	})
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("error while downloading %s: %w", fileName, err)
 	}
-	defer resp.Body.Close()
-	responseBody, err := io.ReadAll(resp.Body)
+	result, err := web.ReadResult(responseBody, request.Id)
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("error while downloading %s: %w", fileName, err)
 	}
-	filecontents := gjson.GetBytes(responseBody, "result.contents")
+	filecontents := gjson.GetBytes(result, "contents")
 	decoded, err := base64.StdEncoding.DecodeString(filecontents.String())
 	if err != nil {
-		panic(err)
+		return err
+	}
+	return writeFile(logger, fileName, destination, decoded, gjson.GetBytes(result, "encoding").String(), limit)
+}
+
+// writeFile decompresses the received contents, at most limit bytes, and writes them to the local file.
+func writeFile(logger *slog.Logger, fileName string, destination string, payload []byte, encoding string, limit int64) error {
+	decoded, err := compression.Decompress(payload, encoding, limit)
+	if err != nil {
+		return fmt.Errorf("error while decompressing %s: %w", fileName, err)
+	}
+	err = replaceFile(destination, func(output io.Writer) error {
+		_, err := output.Write(decoded)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	logger.Info("Downloaded", "file", fileName)
+	return nil
+}
+
+// replaceFile writes a file through a temporary file next to it, which replaces destination once
+// write succeeded, so readers never see partial contents. Missing directories are created.
+func replaceFile(destination string, write func(output io.Writer) error) error {
+	dir, name := filepath.Split(destination)
+	err := os.MkdirAll(filepath.Clean(dir), 0o755)
+	if err != nil {
+		return fmt.Errorf("error while creating the directory of %s: %w", destination, err)
+	}
+	output, err := os.CreateTemp(filepath.Clean(dir), "."+name+".*")
+	if err != nil {
+		return fmt.Errorf("error while creating %s: %w", destination, err)
+	}
+	defer os.Remove(output.Name())
+	err = write(output)
+	if closeErr := output.Close(); err == nil {
+		err = closeErr
 	}
-	_, err = io.Copy(output, bytes.NewReader(decoded))
 	if err != nil {
-		panic(err)
+		return err
 	}
-	fmt.Println("Downloaded ", fileName)
+	return os.Rename(output.Name(), destination)
 }
 
 func newDownloadFilesRequest() *FileSyncRequest {
 	request := new(FileSyncRequest)
+	request.Version = service.JSONRPCVersion
 	request.Method = "FileSync.HandleDownload"
 	return request
 }
 
 func (f *FileSync) RegisterAsWebService(router *mux.Router, server *rpc.Server) {
-	path := "/download/{actionId}/{filename}"
+	path := "/download/{actionId}/{filename:.+}"
 	router.Handle(path, server)
 }
 
 func (f *FileSync) HandleDownload(r *http.Request, args *FileSyncArgs, reply *FileSyncResponse) error {
 	params := mux.Vars(r)
-	filename := params["filename"]
+	payload, encoding, err := f.serveFile(r.Context(), r.RemoteAddr, params["actionId"], params["filename"], args.Encodings)
+	if err != nil {
+		return err
+	}
+	response := FileSyncResponse{FileName: params["filename"], FileContents: base64.StdEncoding.EncodeToString(payload)}
+	if encoding != compression.Identity {
+		response.Encoding = encoding
+	}
+	*reply = response
+	return nil
+}
+
+// serveFile reads a file the ticket grants access to, compressed with one of the encodings when
+// worthwhile, for a client connected from remoteAddr over JSON-RPC.
+func (f *FileSync) serveFile(ctx context.Context, remoteAddr string, ticket string, filename string, encodings []string) ([]byte, string, error) {
+	file, entry, principal, err := f.openFile(ticket, filename)
+	if err != nil {
+		return nil, "", err
+	}
+	defer file.Close()
+	fileContents, err := io.ReadAll(file)
+	if err != nil {
+		return nil, "", err
+	}
+	encoding := f.contentEncoding(entry, principal, fileContents, encodings)
+	payload, encoding, err := compression.Compress(fileContents, encoding)
+	if err != nil {
+		return nil, "", err
+	}
+	hash := sha256.Sum256(fileContents)
+	f.recordServed(ctx, remoteAddr, principal, entry, int64(len(fileContents)), hash[:], encoding, int64(len(payload)))
+	return payload, encoding, nil
+}
+
+// openFile opens a file the ticket grants access to, returning its manifest entry and the principal
+// the ticket was issued to.
+func (f *FileSync) openFile(ticket string, filename string) (*os.File, FileManifestEntry, *service.Principal, error) {
 	if filename == "" {
-		return errors.New("requested file not found")
-	}
-	var response FileSyncResponse
-	filesList := f.Configuration.Files
-	for _, filePath := range filesList {
-		tokens := strings.Split(filePath, "/")
-		enabledFilename := tokens[len(tokens)-1]
-		if filename != enabledFilename {
+		return nil, FileManifestEntry{}, nil, errFileNotFound
+	}
+	principal := f.ticketPrincipal(ticket)
+	if principal == nil {
+		return nil, FileManifestEntry{}, nil, service.NewError(service.CodeExpired, "download link expired, please synchronize again", nil)
+	}
+	manifest, _ := f.currentManifest()
+	manifest = f.permittedManifest(manifest, principal)
+	index := findFile(manifest, filename)
+	if index < 0 {
+		return nil, FileManifestEntry{}, nil, errFileNotFound
+	}
+	file, err := os.Open(manifest[index].File)
+	if err != nil {
+		return nil, FileManifestEntry{}, nil, err
+	}
+	return file, manifest[index], principal, nil
+}
+
+// recordServed audits and logs a file sent to a client, size bytes with the given hash, which took
+// sent bytes with the encoding.
+func (f *FileSync) recordServed(ctx context.Context, remoteAddr string, principal *service.Principal, entry FileManifestEntry, size int64, hash []byte, encoding string, sent int64) {
+	_ = f.audit.Record(audit.Event{
+		Type:       audit.EventFileServed,
+		Username:   principal.Username,
+		RemoteAddr: remoteAddr,
+		Module:     f.id,
+		File:       entry.File,
+		Size:       size,
+		Hash:       hex.EncodeToString(hash),
+	})
+	logging.FromContext(ctx).Info("File served", "module", f.id, "user", principal.Username, "file", entry.File,
+		"size", size, "encoding", encoding, "sent", sent)
+}
+
+// findFile returns the index of the manifest entry with the given path, -1 if there is none. Clients
+// before relative paths request files by base name, which is accepted as long as it is unambiguous.
+func findFile(manifest []FileManifestEntry, filename string) int {
+	index := slices.IndexFunc(manifest, func(entry FileManifestEntry) bool {
+		return entry.Path == filename
+	})
+	if index >= 0 || strings.Contains(filename, "/") {
+		return index
+	}
+	for i, entry := range manifest {
+		if entry.Name != filename {
 			continue
 		}
-		fileContents, err := os.ReadFile(filePath)
-		encodedbytes := base64.StdEncoding.EncodeToString(fileContents)
-		if err != nil {
-			return err
+		if index >= 0 {
+			return -1
 		}
-		response.FileContents = encodedbytes
+		index = i
 	}
-	response.FileName = filename
-	*reply = response
-	return nil
+	return index
+}
+
+// escapePath escapes every segment of a slash separated path for use in a url.
+func escapePath(name string) string {
+	segments := strings.Split(name, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
 }
@@ -0,0 +1,75 @@
+package filesystem
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"lazysync/application/service"
+	"lazysync/application/web"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestExecuteCommandsCancelled(t *testing.T) {
+	const workers = 2
+	started := make(chan struct{}, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Closed connections are only noticed once the request was read.
+		_, _ = io.Copy(io.Discard, r.Body)
+		started <- struct{}{}
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+	connection, err := web.NewConnection(service.ConnectionConfiguration{Retries: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := Init()
+	f.SetLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	f.SetConnection(connection)
+	f.SetServerUrl(server.URL)
+	f.SetDestination(t.TempDir())
+	f.SetTransferLimits(workers, nil)
+	object := &FileSyncObject{DownloadPath: "/files"}
+	for i := range 10 {
+		object.Files = append(object.Files, fmt.Sprintf("file%d.txt", i))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- f.ExecuteCommands(ctx, object)
+	}()
+	for range workers {
+		select {
+		case <-started:
+		case <-time.After(5 * time.Second):
+			t.Fatal("the downloads did not start")
+		}
+	}
+	// Cancel while every worker is downloading and files are still queued.
+	cancel()
+	select {
+	case err = <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("cancelled downloads did not stop")
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("ExecuteCommands failed with %v, want it cancelled", err)
+	}
+	if len(started) > 0 {
+		t.Errorf("%d more downloads started after cancelling", len(started))
+	}
+	files, err := os.ReadDir(f.destination)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) > 0 {
+		t.Errorf("cancelled downloads wrote %d files", len(files))
+	}
+}
@@ -0,0 +1,285 @@
+package filesystem
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/fsnotify/fsnotify"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// WatchModeNotify uses inotify (or the platform equivalent) and falls back to polling when unavailable.
+const WatchModeNotify = "notify"
+
+const WatchModePoll = "poll"
+
+const WatchModeOff = "off"
+
+const pollInterval = 2 * time.Second
+
+// debounceDelay groups bursts of file events (editors, rsync, package managers) into a single change.
+const debounceDelay = 250 * time.Millisecond
+
+// maxDebounceDelay bounds the wait since the first event of a burst, so files written continuously,
+// e.g. growing logs, are still picked up.
+const maxDebounceDelay = 2 * time.Second
+
+// Observe registers onChange, which is called after the cached manifest was rebuilt and the revision was bumped.
+func (f *FileSync) Observe(onChange func()) {
+	f.lock.Lock()
+	f.listeners = append(f.listeners, onChange)
+	f.lock.Unlock()
+}
+
+// Start builds the manifest and starts watching the configured files.
+func (f *FileSync) Start(_ context.Context) error {
+	f.lock.Lock()
+	if f.stop != nil {
+		f.lock.Unlock()
+		return errors.New("module is already started")
+	}
+	stop := make(chan struct{})
+	f.stop = stop
+	f.lock.Unlock()
+	f.refreshManifest()
+	switch f.Configuration.Watch {
+	case WatchModeOff:
+		return nil
+	case WatchModePoll:
+		f.startWorker(stop, f.poll)
+		return nil
+	}
+	watcher, err := f.newNotifyWatcher()
+	if err != nil {
+		f.log().Warn("File notifications are unavailable, falling back to polling", "error", err)
+		f.startWorker(stop, f.poll)
+		return nil
+	}
+	f.startWorker(stop, func(stop <-chan struct{}) {
+		f.watch(watcher, stop)
+	})
+	return nil
+}
+
+// Stop ends watching and waits for the watcher to exit.
+func (f *FileSync) Stop(ctx context.Context) error {
+	f.lock.Lock()
+	stop := f.stop
+	f.stop = nil
+	f.watching = false
+	f.lock.Unlock()
+	if stop == nil {
+		return nil
+	}
+	close(stop)
+	done := make(chan struct{})
+	go func() {
+		f.workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// CheckHealth fails while files should be watched but no watcher is running.
+func (f *FileSync) CheckHealth() error {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	if f.Configuration.Watch != WatchModeOff && !f.watching {
+		return errors.New("file watcher is not running")
+	}
+	return nil
+}
+
+func (f *FileSync) startWorker(stop <-chan struct{}, worker func(stop <-chan struct{})) {
+	f.lock.Lock()
+	f.watching = true
+	f.lock.Unlock()
+	f.workers.Add(1)
+	go func() {
+		defer f.workers.Done()
+		worker(stop)
+	}()
+}
+
+// newNotifyWatcher watches the parent directory of every configured file, so atomic
+// replacements and re-creations are noticed, and every directory of configured trees.
+func (f *FileSync) newNotifyWatcher() (*fsnotify.Watcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	var directories []string
+	for _, path := range f.watchedPaths() {
+		info, err := os.Stat(path)
+		if err != nil || !info.IsDir() {
+			directories = append(directories, filepath.Dir(path))
+			continue
+		}
+		_ = filepath.WalkDir(path, func(dir string, d fs.DirEntry, err error) error {
+			if err == nil && d.IsDir() {
+				directories = append(directories, dir)
+			}
+			return nil
+		})
+	}
+	slices.Sort(directories)
+	for _, dir := range slices.Compact(directories) {
+		err = watcher.Add(dir)
+		if err != nil {
+			watcher.Close()
+			return nil, fmt.Errorf("cannot watch %s: %w", dir, err)
+		}
+	}
+	return watcher, nil
+}
+
+func (f *FileSync) watch(watcher *fsnotify.Watcher, stop <-chan struct{}) {
+	defer watcher.Close()
+	var pending <-chan time.Time
+	var deadline time.Time // Latest refresh of the pending events, zero when none are pending.
+	for {
+		select {
+		case <-stop:
+			return
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if !f.isWatched(event.Name) {
+				continue
+			}
+			if event.Has(fsnotify.Create) {
+				f.watchTree(watcher, event.Name)
+			}
+			now := time.Now()
+			if deadline.IsZero() {
+				deadline = now.Add(maxDebounceDelay)
+			}
+			pending = time.After(min(debounceDelay, deadline.Sub(now)))
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			f.log().Warn("File watcher error", "error", err)
+		case <-pending:
+			pending = nil
+			deadline = time.Time{}
+			f.refreshManifest()
+		}
+	}
+}
+
+// watchTree watches a directory created inside a watched tree and every directory below it, which
+// may have been created before it was watched, e.g. by mkdir -p. Files written before are found by
+// the refresh the creation triggers.
+func (f *FileSync) watchTree(watcher *fsnotify.Watcher, path string) {
+	_ = filepath.WalkDir(path, func(dir string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		err = watcher.Add(dir)
+		if err != nil {
+			f.log().Warn("Cannot watch directory", "directory", dir, "error", err)
+		}
+		return nil
+	})
+}
+
+// isWatched reports whether path is a configured file or lies within a configured directory.
+func (f *FileSync) isWatched(path string) bool {
+	for _, configured := range f.watchedPaths() {
+		if path == configured || strings.HasPrefix(path, strings.TrimSuffix(configured, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *FileSync) poll(stop <-chan struct{}) {
+	state := f.snapshot()
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		current := f.snapshot()
+		if maps.Equal(state, current) {
+			continue
+		}
+		state = current
+		f.refreshManifest()
+	}
+}
+
+// snapshot returns a cheap fingerprint of every configured file built from its size and
+// modification time, so polling only hashes files once something actually changed.
+func (f *FileSync) snapshot() map[string]string {
+	state := map[string]string{}
+	for _, path := range f.watchedPaths() {
+		_ = filepath.WalkDir(path, func(file string, d fs.DirEntry, err error) error {
+			if err != nil {
+				state[file] = ""
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				state[file] = ""
+				return nil
+			}
+			state[file] = fmt.Sprintf("%d:%d", info.Size(), info.ModTime().UnixNano())
+			return nil
+		})
+	}
+	return state
+}
+
+// refreshManifest rebuilds the cached manifest and, if it differs from the cached one,
+// bumps the revision and notifies listeners.
+func (f *FileSync) refreshManifest() {
+	manifest := buildManifest(f.allEntries())
+	f.lock.Lock()
+	if f.revision > 0 && manifestsEqual(f.manifest, manifest) {
+		f.lock.Unlock()
+		return
+	}
+	f.manifest = manifest
+	f.revision++
+	revision := f.revision
+	listeners := slices.Clone(f.listeners)
+	f.lock.Unlock()
+	if revision == 1 {
+		return
+	}
+	f.log().Info("Files changed", "revision", revision, "files", len(manifest))
+	for _, listener := range listeners {
+		listener()
+	}
+}
+
+// currentManifest returns the cached manifest with its revision, rebuilding it when files are not watched.
+func (f *FileSync) currentManifest() ([]FileManifestEntry, uint64) {
+	f.lock.RLock()
+	if f.watching {
+		defer f.lock.RUnlock()
+		return f.manifest, f.revision
+	}
+	f.lock.RUnlock()
+	f.refreshManifest()
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	return f.manifest, f.revision
+}
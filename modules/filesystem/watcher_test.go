@@ -0,0 +1,115 @@
+package filesystem
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// startWatching starts the module serving directory with notifications and counts its changes.
+func startWatching(t *testing.T, directory string) (*FileSync, *atomic.Int32) {
+	t.Helper()
+	f := Init()
+	err := f.SetConfiguration(FileSyncConfig{Files: []FileEntry{{Path: directory}}, Watch: WatchModeNotify})
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes := &atomic.Int32{}
+	f.Observe(func() {
+		changes.Add(1)
+	})
+	err = f.Start(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = f.Stop(context.Background())
+	})
+	if f.CheckHealth() != nil {
+		t.Skip("file notifications are unavailable")
+	}
+	return f, changes
+}
+
+// waitFor polls condition until it holds or timeout passed.
+func waitFor(timeout time.Duration, condition func() bool) bool {
+	for deadline := time.Now().Add(timeout); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if condition() {
+			return true
+		}
+	}
+	return condition()
+}
+
+func manifestHas(f *FileSync, file string) bool {
+	manifest, _ := f.currentManifest()
+	for _, entry := range manifest {
+		if entry.File == file {
+			return true
+		}
+	}
+	return false
+}
+
+func TestWatchNewDirectories(t *testing.T) {
+	tests := []struct {
+		name string
+		tree string // Directories created at once below the served directory.
+	}{
+		{"directory", "a"},
+		{"nested directories", "a/b/c"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			directory := t.TempDir()
+			f, _ := startWatching(t, directory)
+			tree := filepath.Join(directory, filepath.FromSlash(test.tree))
+			err := os.MkdirAll(tree, 0755)
+			if err != nil {
+				t.Fatal(err)
+			}
+			early := filepath.Join(tree, "early.txt")
+			err = os.WriteFile(early, []byte("early"), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !waitFor(5*time.Second, func() bool { return manifestHas(f, early) }) {
+				t.Fatalf("%s written right after creating its directory is missing from the manifest", early)
+			}
+			// Files written later are only noticed when the new directories are watched.
+			late := filepath.Join(tree, "late.txt")
+			err = os.WriteFile(late, []byte("late"), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !waitFor(5*time.Second, func() bool { return manifestHas(f, late) }) {
+				t.Fatalf("%s is missing from the manifest", late)
+			}
+		})
+	}
+}
+
+func TestWatchContinuousWrites(t *testing.T) {
+	directory := t.TempDir()
+	_, changes := startWatching(t, directory)
+	log, err := os.Create(filepath.Join(directory, "app.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+	// Writes arrive faster than debounceDelay for longer than maxDebounceDelay.
+	start := time.Now()
+	for time.Since(start) < maxDebounceDelay+time.Second && changes.Load() == 0 {
+		_, err = log.WriteString("line\n")
+		if err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(debounceDelay / 5)
+	}
+	if changes.Load() == 0 {
+		t.Fatalf("no change reported after %s of continuous writes", time.Since(start).Round(time.Millisecond))
+	}
+}
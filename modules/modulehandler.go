@@ -1,49 +1,148 @@
 package modules
 
 import (
+	"context"
 	"fmt"
 	"github.com/gorilla/mux"
-	"github.com/gorilla/rpc"
+	"github.com/gorilla/rpc/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"lazysync/application/audit"
+	"lazysync/application/bandwidth"
 	"lazysync/application/service"
-	"lazysync/modules/filesystem"
+	"lazysync/application/web"
+	"log/slog"
+	"slices"
 )
 
+// Module is implemented by every module. SetConfiguration rejects invalid configurations with an
+// error, the server does not start and the client does not synchronize the module then.
 type Module interface {
 	GetId() string
 	SetupModule()
 	GetConfigurationValues() interface{}
-	SetConfiguration(configuration interface{})
-	Sync() service.SyncObject
+	SetConfiguration(configuration interface{}) error
+	Sync(principal *service.Principal) service.SyncObject
 	GetSyncObjectInstance() service.SyncObject
-	ExecuteCommands(object service.SyncObject)
+	ExecuteCommands(ctx context.Context, object service.SyncObject) error
 }
 
 type WebServiceModule interface {
 	RegisterAsWebService(router *mux.Router, server *rpc.Server)
 }
 
+// GRPCModule is implemented by modules offering gRPC services next to their web services.
+// RegisterGRPCService is only called when the server has gRPC enabled.
+type GRPCModule interface {
+	RegisterGRPCService(registrar grpc.ServiceRegistrar)
+}
+
+// GRPCClientModule is implemented by modules able to transfer their data over gRPC. Clients
+// configured to use gRPC hand them their connection before executing commands.
+type GRPCClientModule interface {
+	SetGRPCConnection(conn grpc.ClientConnInterface)
+}
+
+// ObservableModule is implemented by modules able to detect changes of the data they synchronize.
+// The server calls Observe once, and the module calls onChange every time the data changes.
+type ObservableModule interface {
+	Observe(onChange func())
+}
+
+// LifecycleModule is implemented by modules running background work on the server.
+// Start is called once the module is configured, Stop when the server shuts down.
+type LifecycleModule interface {
+	Start(ctx context.Context) error
+	Stop(ctx context.Context) error
+}
+
+// GroupAwareModule is implemented by modules accepting group specific configuration on the server.
+// SetGroupConfiguration is called after SetConfiguration for every group configuring the module,
+// rejecting invalid configurations like SetConfiguration does.
+type GroupAwareModule interface {
+	SetGroupConfiguration(group string, configuration interface{}) error
+}
+
+// AuditedModule is implemented by modules recording their own events, e.g. served files, in the audit log.
+type AuditedModule interface {
+	SetAuditLog(log *audit.Log)
+}
+
+// LoggingModule is implemented by modules writing logs, the logger is set before the module is used.
+type LoggingModule interface {
+	SetLogger(logger *slog.Logger)
+}
+
+// MetricsModule is implemented by modules exposing their own metrics on the server metrics endpoint.
+type MetricsModule interface {
+	RegisterMetrics(registerer prometheus.Registerer) error
+}
+
+// RemoteModule is implemented by client modules contacting the server on their own, e.g. to download files.
+// The client sets the configured server url and the connection to send requests with before
+// executing commands.
+type RemoteModule interface {
+	SetServerUrl(serverUrl string)
+	SetConnection(connection *web.Connection)
+}
+
+// TransferModule is implemented by client modules downloading data. The client passes the amount of
+// parallel downloads and the limiter shared by all transfers before executing commands.
+type TransferModule interface {
+	SetTransferLimits(workers int, limiter *bandwidth.Limiter)
+}
+
+// ProgressModule is implemented by client modules reporting the progress of their transfers,
+// e.g. every downloaded file. The client fills in the module of the reported events.
+type ProgressModule interface {
+	SetProgress(report func(progress service.Progress))
+}
+
+// DestinationModule is implemented by client modules writing local files. The client sets the
+// directory they belong in, the working directory when unset.
+type DestinationModule interface {
+	SetDestination(directory string)
+}
+
+// CapabilityModule is implemented by modules announcing optional features in the server handshake.
+type CapabilityModule interface {
+	Capabilities() []string
+}
+
+// FeatureModule is implemented by client modules adapting to the capabilities the server announced
+// for them. It is not called for servers predating the handshake.
+type FeatureModule interface {
+	SetServerCapabilities(capabilities []string)
+}
+
+// HealthCheckedModule is implemented by modules reporting their state on the server readiness endpoint.
+type HealthCheckedModule interface {
+	CheckHealth() error
+}
+
 type ModuleHandler struct {
 	ModulesList map[string]Module
 }
 
+// InitModuleHandler returns a handler holding a new instance of every registered module.
 func InitModuleHandler() *ModuleHandler {
 	return &ModuleHandler{
-		ModulesList: findModules(),
+		ModulesList: newModules(),
 	}
 }
 
-func findModules() map[string]Module {
-	filesync := filesystem.Init()
-	return map[string]Module{
-		filesync.GetId(): filesync,
-	}
+// Register offers an additional module, replacing a module with the same id.
+func (mh *ModuleHandler) Register(module Module) {
+	mh.ModulesList[module.GetId()] = module
 }
 
+// GetModuleNamesList returns the ids of the modules, sorted.
 func (mh *ModuleHandler) GetModuleNamesList() []string {
-	var moduleNames []string
+	moduleNames := make([]string, 0, len(mh.ModulesList))
 	for name := range mh.ModulesList {
 		moduleNames = append(moduleNames, name)
 	}
+	slices.Sort(moduleNames)
 	return moduleNames
 }
 
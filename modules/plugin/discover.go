@@ -0,0 +1,70 @@
+package plugin
+
+import (
+	"errors"
+	"fmt"
+	"lazysync/application/service"
+	"lazysync/modules"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Discover returns a plugin for every executable file in the directory of settings, sorted by module
+// id. Hidden files and files not executable by anyone are skipped.
+func Discover(settings service.PluginConfiguration) ([]*Plugin, error) {
+	directory := settings.Directory
+	entries, err := os.ReadDir(directory)
+	if err != nil {
+		return nil, err
+	}
+	var plugins []*Plugin
+	files := map[string]string{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+		path := filepath.Join(directory, name)
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.Mode().IsRegular() || info.Mode().Perm()&0111 == 0 {
+			continue
+		}
+		id := strings.TrimSuffix(name, filepath.Ext(name))
+		if id == "" || strings.ContainsAny(id, " \t\n") {
+			return nil, errors.New("invalid module id for plugin " + path)
+		}
+		if other, ok := files[id]; ok {
+			return nil, fmt.Errorf("plugins %s and %s both provide the module %s", other, name, id)
+		}
+		files[id] = name
+		plugins = append(plugins, New(id, path, settings))
+	}
+	slices.SortFunc(plugins, func(a, b *Plugin) int {
+		return strings.Compare(a.id, b.id)
+	})
+	return plugins, nil
+}
+
+// Load adds the plugins of the configured directory to the modules of handler. It rejects plugins
+// named like a module of the handler, and does nothing when no directory is configured.
+func Load(handler *modules.ModuleHandler, settings service.PluginConfiguration) error {
+	if settings.Directory == "" {
+		return nil
+	}
+	plugins, err := Discover(settings)
+	if err != nil {
+		return fmt.Errorf("cannot load plugins: %w", err)
+	}
+	for _, plugin := range plugins {
+		if _, err := handler.GetModuleByName(plugin.GetId()); err == nil {
+			return fmt.Errorf("plugin %s conflicts with the module %s", plugin.Path(), plugin.GetId())
+		}
+		handler.Register(plugin)
+	}
+	return nil
+}
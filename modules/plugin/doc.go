@@ -0,0 +1,38 @@
+// Package plugin runs sync modules implemented by external executables, so modules can be written
+// in any language and without rebuilding lazysync.
+//
+// Every executable file in the plugins directory is a module named after the file without its
+// extension: plugins/inventory.py provides the module "inventory". Modules compiled into lazysync
+// take precedence, a plugin named like one of them is rejected.
+//
+// # Protocol
+//
+// Every call starts the executable, writes a single JSON-RPC 2.0 request followed by a newline to
+// its standard input and reads a single JSON-RPC 2.0 response from its standard output. The process
+// then has to exit with status 0. Standard error is logged line by line. Calls taking longer than
+// the configured timeout, 30 seconds by default, are killed, as are the sync calls still running when
+// the server stops. At most max_concurrent calls of a plugin, 4 by default, run at once; further calls
+// wait for a running one to finish. A plugin failing or misbehaving in any way fails the call it was
+// started for, never the process running it.
+//
+//	{"jsonrpc":"2.0","id":1,"method":"sync","params":{"config":{"path":"/srv"},"principal":{"username":"alice","groups":["web"]}}}
+//	{"jsonrpc":"2.0","id":1,"result":{"items":["a","b"]}}
+//
+// Errors are reported with an error object instead of a result. Its code and message reach the
+// client when returned by sync, e.g. -32003 for denied access:
+//
+//	{"jsonrpc":"2.0","id":1,"error":{"code":-32003,"message":"access denied"}}
+//
+// The methods are:
+//
+//   - setup, params {}: returns the configuration proposed for the module by "lazysync setup".
+//   - get_config, params {}: returns the default configuration of the module.
+//   - sync, params {"config", "principal": {"username", "groups"}}: called on the server when a
+//     client synchronizes, returns the sync object sent to the client, any JSON value but null.
+//   - execute_commands, params {"config", "object", "directory"}: called on the client with the
+//     sync object returned by the server, applies it below directory, the working directory when
+//     empty. The result is ignored.
+//
+// Plugins keep no state between calls, config carries the config section of the module on the
+// side making the call, null when unset.
+package plugin
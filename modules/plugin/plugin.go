@@ -0,0 +1,349 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"lazysync/application/service"
+	"log/slog"
+	"os/exec"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Methods of the plugin protocol.
+const (
+	MethodSetup           = "setup"
+	MethodGetConfig       = "get_config"
+	MethodSync            = "sync"
+	MethodExecuteCommands = "execute_commands"
+)
+
+// maxResponseSize bounds the output read from a plugin.
+const maxResponseSize = 64 << 20
+
+// maxLogLine bounds the lines of standard error logged at once.
+const maxLogLine = 4096
+
+var errResponseTooLarge = errors.New("response too large")
+
+// Plugin adapts an executable speaking the plugin protocol to modules.Module.
+type Plugin struct {
+	id          string
+	path        string
+	timeout     time.Duration
+	calls       chan struct{} // Holds a value for every running call.
+	config      any
+	logger      *slog.Logger
+	destination string
+
+	lock   sync.Mutex
+	ctx    context.Context // Cancelled once the server stops, nil unless started.
+	cancel context.CancelFunc
+}
+
+// SyncObject carries the JSON value returned by the sync method of a plugin. A sync object of a
+// failed call fails to encode, which fails the synchronization it was requested for.
+type SyncObject struct {
+	Data json.RawMessage
+	err  error
+}
+
+type request struct {
+	Version string `json:"jsonrpc"`
+	ID      int    `json:"id"`
+	Method  string `json:"method"`
+	Params  any    `json:"params"`
+}
+
+type response struct {
+	Version string          `json:"jsonrpc"`
+	ID      int             `json:"id"`
+	Result  json.RawMessage `json:"result"`
+	Error   *service.Error  `json:"error"`
+}
+
+type principal struct {
+	Username string   `json:"username"`
+	Groups   []string `json:"groups"`
+}
+
+type syncParams struct {
+	Config    any       `json:"config"`
+	Principal principal `json:"principal"`
+}
+
+type executeParams struct {
+	Config    any             `json:"config"`
+	Object    json.RawMessage `json:"object"`
+	Directory string          `json:"directory"`
+}
+
+// New returns the module provided by the executable at path, its calls are limited by settings.
+func New(id string, path string, settings service.PluginConfiguration) *Plugin {
+	settings = settings.WithDefaults()
+	return &Plugin{id: id, path: path, timeout: settings.Timeout, calls: make(chan struct{}, settings.MaxConcurrent)}
+}
+
+func (p *Plugin) GetId() string {
+	return p.id
+}
+
+// Path returns the executable of the plugin.
+func (p *Plugin) Path() string {
+	return p.path
+}
+
+func (p *Plugin) SetLogger(logger *slog.Logger) {
+	p.logger = logger
+}
+
+func (p *Plugin) SetDestination(directory string) {
+	p.destination = directory
+}
+
+func (p *Plugin) log() *slog.Logger {
+	if p.logger == nil {
+		return slog.Default().With("module", p.id)
+	}
+	return p.logger
+}
+
+// SetupModule takes the configuration proposed by the plugin, it keeps the current one when the call fails.
+func (p *Plugin) SetupModule() {
+	var config any
+	err := p.call(context.Background(), MethodSetup, struct{}{}, &config)
+	if err != nil {
+		p.log().Error("Plugin setup failed", "error", err)
+		return
+	}
+	p.config = config
+}
+
+// GetConfigurationValues returns the configuration of the module, the default one of the plugin when unset.
+func (p *Plugin) GetConfigurationValues() any {
+	if p.config != nil {
+		return p.config
+	}
+	var config any
+	err := p.call(context.Background(), MethodGetConfig, struct{}{}, &config)
+	if err != nil {
+		p.log().Warn("Plugin has no default configuration", "error", err)
+		return nil
+	}
+	return config
+}
+
+// SetConfiguration keeps the configuration for the calls of the plugin, which checks it itself.
+func (p *Plugin) SetConfiguration(configuration any) error {
+	p.config = configuration
+	return nil
+}
+
+// Start ties the sync calls of the plugin to ctx, running calls are killed once the server stops.
+func (p *Plugin) Start(ctx context.Context) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.cancel != nil {
+		return errors.New("module is already started")
+	}
+	p.ctx, p.cancel = context.WithCancel(ctx)
+	return nil
+}
+
+// Stop kills the running sync calls of the plugin and fails further ones.
+func (p *Plugin) Stop(_ context.Context) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.cancel != nil {
+		p.cancel()
+	}
+	return nil
+}
+
+// syncContext returns the context of sync calls, which are not cancelled unless the plugin was started.
+func (p *Plugin) syncContext() context.Context {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.ctx == nil {
+		return context.Background()
+	}
+	return p.ctx
+}
+
+func (p *Plugin) Sync(principal *service.Principal) service.SyncObject {
+	params := syncParams{Config: p.config}
+	if principal != nil {
+		params.Principal.Username = principal.Username
+		params.Principal.Groups = principal.Groups
+	}
+	object := &SyncObject{}
+	err := p.call(p.syncContext(), MethodSync, params, &object.Data)
+	if err == nil && !object.present() {
+		err = errors.New("plugin " + p.id + " returned no sync object")
+	}
+	if err != nil {
+		p.log().Warn("Plugin sync failed", "error", err)
+		object.err = publicError(err)
+	}
+	return object
+}
+
+func (p *Plugin) GetSyncObjectInstance() service.SyncObject {
+	return &SyncObject{}
+}
+
+func (p *Plugin) ExecuteCommands(ctx context.Context, object service.SyncObject) error {
+	syncObject, err := service.SyncObjectAs[*SyncObject](object)
+	if err != nil {
+		return err
+	}
+	params := executeParams{Config: p.config, Object: syncObject.Data, Directory: p.destination}
+	return p.call(ctx, MethodExecuteCommands, params, nil)
+}
+
+// call runs the plugin for a single request and decodes the result into result, unless nil. Calls
+// waiting for others to finish count against the timeout.
+func (p *Plugin) call(ctx context.Context, method string, params any, result any) error {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+	select {
+	case p.calls <- struct{}{}:
+		defer func() { <-p.calls }()
+	case <-ctx.Done():
+		return p.callError(ctx, method)
+	}
+	payload, err := json.Marshal(request{Version: service.JSONRPCVersion, ID: 1, Method: method, Params: params})
+	if err != nil {
+		return err
+	}
+	command := exec.CommandContext(ctx, p.path)
+	command.Stdin = bytes.NewReader(append(payload, '\n'))
+	stdout := &limitedBuffer{limit: maxResponseSize}
+	command.Stdout = stdout
+	stderr := &logWriter{logger: p.log().With("method", method)}
+	command.Stderr = stderr
+	// Children of a killed plugin may keep its output open, stop waiting for them.
+	command.WaitDelay = time.Second
+	err = command.Run()
+	stderr.Flush()
+	if ctx.Err() != nil {
+		return p.callError(ctx, method)
+	}
+	if err != nil {
+		return fmt.Errorf("plugin %s: %s failed: %w", p.id, method, err)
+	}
+	var reply response
+	err = json.Unmarshal(stdout.Bytes(), &reply)
+	if err != nil {
+		return fmt.Errorf("plugin %s: invalid response to %s: %w", p.id, method, err)
+	}
+	if reply.Version != service.JSONRPCVersion || reply.ID != 1 {
+		return fmt.Errorf("plugin %s: invalid response to %s: not a JSON-RPC 2.0 response to the request", p.id, method)
+	}
+	if reply.Error != nil {
+		return fmt.Errorf("plugin %s: %w", p.id, reply.Error)
+	}
+	if result == nil {
+		return nil
+	}
+	if reply.Result == nil {
+		return fmt.Errorf("plugin %s: invalid response to %s: no result", p.id, method)
+	}
+	return json.Unmarshal(reply.Result, result)
+}
+
+// callError is the error of a call cancelled or timed out through ctx.
+func (p *Plugin) callError(ctx context.Context, method string) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("plugin %s: %s timed out after %s: %w", p.id, method, p.timeout, ctx.Err())
+	}
+	return ctx.Err()
+}
+
+// publicError is the error reported to clients for a failed sync. Errors reported by the plugin
+// keep their code and message, other failures are only detailed in the server log.
+func publicError(err error) error {
+	var serviceError *service.Error
+	if errors.As(err, &serviceError) {
+		return serviceError
+	}
+	return service.NewError(service.CodeServerError, "module unavailable", nil)
+}
+
+func (o *SyncObject) present() bool {
+	data := bytes.TrimSpace(o.Data)
+	return len(data) > 0 && !bytes.Equal(data, []byte("null"))
+}
+
+func (o *SyncObject) MarshalJSON() ([]byte, error) {
+	if o.err != nil {
+		return nil, o.err
+	}
+	return o.Data, nil
+}
+
+func (o *SyncObject) UnmarshalJSON(data []byte) error {
+	o.Data = slices.Clone(data)
+	return nil
+}
+
+func (o *SyncObject) Validate() error {
+	if !o.present() {
+		return errors.New("missing plugin data")
+	}
+	return nil
+}
+
+// limitedBuffer collects the output of a plugin, failing once it exceeds limit.
+type limitedBuffer struct {
+	bytes.Buffer
+	limit int
+}
+
+func (b *limitedBuffer) Write(data []byte) (int, error) {
+	if b.Len()+len(data) > b.limit {
+		return 0, errResponseTooLarge
+	}
+	return b.Buffer.Write(data)
+}
+
+// logWriter logs the standard error of a plugin line by line.
+type logWriter struct {
+	logger *slog.Logger
+	line   []byte
+}
+
+func (w *logWriter) Write(data []byte) (int, error) {
+	w.line = append(w.line, data...)
+	for {
+		i := bytes.IndexByte(w.line, '\n')
+		if i < 0 {
+			break
+		}
+		w.log(w.line[:i])
+		w.line = w.line[i+1:]
+	}
+	if len(w.line) > maxLogLine {
+		w.Flush()
+	}
+	return len(data), nil
+}
+
+// Flush logs the last line when it did not end with a newline.
+func (w *logWriter) Flush() {
+	if len(w.line) > 0 {
+		w.log(w.line)
+		w.line = nil
+	}
+}
+
+func (w *logWriter) log(line []byte) {
+	line = bytes.TrimRight(line, "\r")
+	if len(line) > 0 {
+		w.logger.Info("Plugin output", "line", string(line))
+	}
+}
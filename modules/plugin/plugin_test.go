@@ -0,0 +1,178 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"lazysync/application/service"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestPlugin returns a plugin running a shell script which keeps a file in directory/running
+// while it runs, appends the amount of running calls to directory/calls, sleeps for sleep and
+// answers with an empty object.
+func newTestPlugin(t *testing.T, sleep time.Duration, settings service.PluginConfiguration) (*Plugin, string) {
+	t.Helper()
+	directory := t.TempDir()
+	running := filepath.Join(directory, "running")
+	err := os.Mkdir(running, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	script := fmt.Sprintf(`#!/bin/sh
+read -r request
+touch %[1]s/$$
+ls %[1]s | wc -l >> %[2]s
+sleep %[3]f
+rm %[1]s/$$
+echo '{"jsonrpc": "2.0", "id": 1, "result": {}}'
+`, running, filepath.Join(directory, "calls"), sleep.Seconds())
+	path := filepath.Join(directory, "plugin.sh")
+	err = os.WriteFile(path, []byte(script), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := New("test", path, settings)
+	p.SetLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	return p, directory
+}
+
+// calls returns the amount of running calls each call of the plugin saw when it started.
+func calls(t *testing.T, directory string) []int {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(directory, "calls"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	var counts []int
+	for _, field := range strings.Fields(string(data)) {
+		count, err := strconv.Atoi(field)
+		if err != nil {
+			t.Fatal(err)
+		}
+		counts = append(counts, count)
+	}
+	return counts
+}
+
+func TestCallsAreLimited(t *testing.T) {
+	const sleep = 200 * time.Millisecond
+	tests := []struct {
+		name          string
+		maxConcurrent int
+		calls         int
+	}{
+		{"one at a time", 1, 3},
+		{"two at a time", 2, 6},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p, directory := newTestPlugin(t, sleep, service.PluginConfiguration{MaxConcurrent: test.maxConcurrent})
+			start := time.Now()
+			var wg sync.WaitGroup
+			errs := make([]error, test.calls)
+			for i := range errs {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					errs[i] = p.ExecuteCommands(context.Background(), &SyncObject{Data: []byte("{}")})
+				}()
+			}
+			wg.Wait()
+			elapsed := time.Since(start)
+			for _, err := range errs {
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			running := calls(t, directory)
+			if len(running) != test.calls {
+				t.Fatalf("plugin ran %d times, want %d", len(running), test.calls)
+			}
+			for _, count := range running {
+				if count > test.maxConcurrent {
+					t.Errorf("%d calls ran at once, want at most %d", count, test.maxConcurrent)
+				}
+			}
+			rounds := time.Duration(test.calls / test.maxConcurrent)
+			if elapsed < rounds*sleep {
+				t.Errorf("calls finished after %s, want at least %s", elapsed, rounds*sleep)
+			}
+		})
+	}
+}
+
+func TestWaitingCallsTimeOut(t *testing.T) {
+	const timeout = 300 * time.Millisecond
+	p, directory := newTestPlugin(t, 10*time.Second, service.PluginConfiguration{Timeout: timeout, MaxConcurrent: 1})
+	first := make(chan error, 1)
+	go func() {
+		first <- p.ExecuteCommands(context.Background(), &SyncObject{Data: []byte("{}")})
+	}()
+	// Let the first call take the only slot.
+	time.Sleep(timeout / 3)
+	start := time.Now()
+	err := p.ExecuteCommands(context.Background(), &SyncObject{Data: []byte("{}")})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("waiting call failed with %v, want a timeout", err)
+	}
+	// The running call only ends once its timeout passed and the plugin was killed.
+	if elapsed := time.Since(start); elapsed > timeout*3/2 {
+		t.Errorf("waiting call failed after %s, want it to time out after %s", elapsed, timeout)
+	}
+	err = <-first
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("running call failed with %v, want a timeout", err)
+	}
+	if running := calls(t, directory); len(running) != 1 {
+		t.Errorf("plugin ran %d times, want only the first call to run", len(running))
+	}
+}
+
+func TestStopCancelsSyncCalls(t *testing.T) {
+	p, directory := newTestPlugin(t, 10*time.Second, service.PluginConfiguration{})
+	err := p.Start(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	synced := make(chan service.SyncObject, 1)
+	go func() {
+		synced <- p.Sync(&service.Principal{Username: "alice"})
+	}()
+	for deadline := time.Now().Add(5 * time.Second); len(calls(t, directory)) == 0; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("the plugin did not start")
+		}
+	}
+	err = p.Stop(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case object := <-synced:
+		if object.(*SyncObject).err == nil {
+			t.Error("cancelled sync returned a sync object")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the running sync was not cancelled")
+	}
+	// Calls after stopping fail right away.
+	object := p.Sync(&service.Principal{Username: "alice"})
+	if object.(*SyncObject).err == nil {
+		t.Error("sync after stopping returned a sync object")
+	}
+	if running := calls(t, directory); len(running) != 1 {
+		t.Errorf("plugin ran %d times, want only the cancelled call to run", len(running))
+	}
+}
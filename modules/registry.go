@@ -0,0 +1,84 @@
+package modules
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Factory returns a new instance of a module, every module handler gets its own instances.
+type Factory func() Module
+
+// Metadata describes a registered module.
+type Metadata struct {
+	ID          string
+	Description string
+	Version     string
+	// ConfigSchema is a value of the type the module decodes its configuration into, e.g. the zero
+	// value of its configuration struct. Its yaml tags are the keys the configuration accepts, a
+	// pointer to it may implement service.ConfigDefaults and service.ConfigValidator. See
+	// DecodeConfiguration.
+	ConfigSchema any
+}
+
+type registration struct {
+	metadata Metadata
+	factory  Factory
+}
+
+var (
+	registryLock sync.RWMutex
+	registry     = map[string]registration{}
+)
+
+// Register makes a module available to the server, the client and setup. Modules call it from
+// init, programs import them, e.g. through lazysync/modules/builtin, for this side effect.
+// Register panics when the id is empty or already registered, like sql.Register.
+func Register(metadata Metadata, factory Factory) {
+	if metadata.ID == "" || strings.ContainsAny(metadata.ID, " \t\n") {
+		panic(fmt.Sprintf("modules: invalid module id %q", metadata.ID))
+	}
+	if factory == nil {
+		panic("modules: Register factory is nil for " + metadata.ID)
+	}
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	if _, ok := registry[metadata.ID]; ok {
+		panic("modules: Register called twice for " + metadata.ID)
+	}
+	registry[metadata.ID] = registration{metadata: metadata, factory: factory}
+}
+
+// Registered returns the metadata of every registered module, sorted by id.
+func Registered() []Metadata {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+	registered := make([]Metadata, 0, len(registry))
+	for _, entry := range registry {
+		registered = append(registered, entry.metadata)
+	}
+	slices.SortFunc(registered, func(a, b Metadata) int {
+		return strings.Compare(a.ID, b.ID)
+	})
+	return registered
+}
+
+// Lookup returns the metadata of a registered module.
+func Lookup(id string) (Metadata, bool) {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+	entry, ok := registry[id]
+	return entry.metadata, ok
+}
+
+// newModules returns a new instance of every registered module.
+func newModules() map[string]Module {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+	instances := make(map[string]Module, len(registry))
+	for id, entry := range registry {
+		instances[id] = entry.factory()
+	}
+	return instances
+}
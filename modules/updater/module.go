@@ -1,17 +1,58 @@
 package updater
 
+import (
+	"context"
+	"errors"
+	"lazysync/application/service"
+	"lazysync/modules"
+	"log/slog"
+)
+
 const ID = "updater"
 
+const Version = "1.0.0"
+
 type Update struct {
 	id            string
 	Configuration *UpdateConfig
+	logger        *slog.Logger
 }
 
+// UpdateConfig names the application and its version: the latest one on the server, the installed
+// one on clients. The configuration is optional on clients.
 type UpdateConfig struct {
-	AppName    string `toml:"name"`
+	AppName    string `yaml:"name"`
 	AppVersion int    `yaml:"version"`
 }
 
+func (c *UpdateConfig) Validate() error {
+	if c.AppName == "" {
+		return errors.New("missing application name")
+	}
+	return nil
+}
+
+// UpdateSyncObject announces the latest version of the application.
+type UpdateSyncObject struct {
+	AppName    string
+	AppVersion int
+}
+
+func init() {
+	modules.Register(modules.Metadata{
+		ID:           ID,
+		Description:  "Announces new versions of an application to clients",
+		Version:      Version,
+		ConfigSchema: UpdateConfig{},
+	}, func() modules.Module {
+		return Init()
+	})
+}
+
+func Init() *Update {
+	return &Update{id: ID, Configuration: &UpdateConfig{}}
+}
+
 func (up *Update) GetId() string {
 	return up.id
 }
@@ -19,12 +60,68 @@ func (up *Update) GetId() string {
 func (up *Update) SetupModule() {
 }
 
+func (up *Update) SetLogger(logger *slog.Logger) {
+	up.logger = logger
+}
+
+func (up *Update) log() *slog.Logger {
+	if up.logger == nil {
+		return slog.Default()
+	}
+	return up.logger
+}
+
 func (up *Update) GetConfigurationValues() any {
 	return up.Configuration
 }
 
-func (up *Update) Sync() {}
+func (up *Update) SetConfiguration(configuration any) error {
+	if config, ok := configuration.(UpdateConfig); ok {
+		up.Configuration = &config
+		return nil
+	}
+	config := &UpdateConfig{}
+	err := service.DecodeModuleConfiguration(configuration, config)
+	if err != nil {
+		return err
+	}
+	up.Configuration = config
+	return nil
+}
 
-func Init() *Update {
-	return &Update{id: ID}
+func (up *Update) Sync(principal *service.Principal) service.SyncObject {
+	return &UpdateSyncObject{AppName: up.Configuration.AppName, AppVersion: up.Configuration.AppVersion}
+}
+
+func (up *Update) GetSyncObjectInstance() service.SyncObject {
+	return &UpdateSyncObject{}
+}
+
+// ExecuteCommands reports whether the server announces a newer version than the installed one.
+// Clients without configuration know no installed version, they only report the announced one.
+func (up *Update) ExecuteCommands(ctx context.Context, object service.SyncObject) error {
+	update, err := service.SyncObjectAs[*UpdateSyncObject](object)
+	if err != nil {
+		return err
+	}
+	if up.Configuration.AppName == "" {
+		up.log().Info("Latest version", "name", update.AppName, "version", update.AppVersion)
+		return nil
+	}
+	if update.AppName != up.Configuration.AppName {
+		return errors.New("server announces " + update.AppName + ", not " + up.Configuration.AppName)
+	}
+	if update.AppVersion > up.Configuration.AppVersion {
+		up.log().Info("Update available", "name", update.AppName, "version", update.AppVersion, "installed", up.Configuration.AppVersion)
+		return nil
+	}
+	up.log().Info("Up to date", "name", update.AppName, "version", up.Configuration.AppVersion)
+	return nil
+}
+
+func (o *UpdateSyncObject) Validate() error {
+	if o.AppName == "" {
+		return errors.New("missing application name")
+	}
+	return nil
 }
@@ -0,0 +1,260 @@
+// Package client synchronizes with a lazysync server from other Go programs, without the CLI.
+// It runs the same code as "lazysync run":
+//
+//	c, err := client.New(
+//		client.WithServerUrl("http://sync.example.com:8080"),
+//		client.WithUsername("alice"),
+//		client.WithKeyFile("/etc/lazysync/alice.rsa"),
+//		client.WithDirectory("/var/lib/app"),
+//		client.WithProgress(func(p client.Progress) { log.Println(p.Type, p.File) }),
+//	)
+//	if err != nil {
+//		return err
+//	}
+//	defer c.Close()
+//	err = c.Sync(ctx, "filesystem")
+//
+// Nothing is read from the working directory unless the options point there, and failures are
+// returned as errors instead of terminating the process.
+package client
+
+import (
+	"context"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"io"
+	"lazysync/application/bandwidth"
+	appclient "lazysync/application/client"
+	"lazysync/application/service"
+	"log/slog"
+	"os"
+)
+
+// Progress reports a step of a synchronization, see the Progress constants for its types.
+type Progress = service.Progress
+
+const (
+	ProgressModuleStarted  = service.ProgressModuleStarted
+	ProgressModuleFinished = service.ProgressModuleFinished
+	ProgressFileStarted    = service.ProgressFileStarted
+	ProgressFileSkipped    = service.ProgressFileSkipped
+	ProgressFileFinished   = service.ProgressFileFinished
+	ProgressFileFailed     = service.ProgressFileFailed
+)
+
+// Client is a connection to a lazysync server. It is safe for concurrent use, synchronizations of
+// the same module should not run concurrently though, as they write the same files.
+type Client struct {
+	client *appclient.Client
+}
+
+type options struct {
+	configuration *service.AppConfiguration
+	serverUrl     string
+	username      string
+	key           *rsa.PrivateKey
+	keyFile       string
+	directory     string
+	connection    *service.ConnectionConfiguration
+	workers       int
+	maxRate       bandwidth.Rate
+	logger        *slog.Logger
+	progress      func(Progress)
+}
+
+// Option configures a Client.
+type Option func(o *options) error
+
+// WithConfigFile reads the settings from a lazysync configuration file, other options override them.
+func WithConfigFile(path string) Option {
+	return func(o *options) error {
+		contents, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		o.configuration, err = service.ParseConfiguration(contents)
+		return err
+	}
+}
+
+// WithConfiguration uses an already loaded configuration, other options override its settings.
+func WithConfiguration(configuration *service.AppConfiguration) Option {
+	return func(o *options) error {
+		o.configuration = configuration
+		return nil
+	}
+}
+
+// WithServerUrl sets the url of the server, http://host:port or unix:///path.
+func WithServerUrl(serverUrl string) Option {
+	return func(o *options) error {
+		o.serverUrl = serverUrl
+		return nil
+	}
+}
+
+func WithUsername(username string) Option {
+	return func(o *options) error {
+		o.username = username
+		return nil
+	}
+}
+
+// WithPrivateKey sets the key signing logins. Without it and WithKeyFile, the key is read from
+// private/keys/<username>/key.rsa in the working directory.
+func WithPrivateKey(key *rsa.PrivateKey) Option {
+	return func(o *options) error {
+		o.key = key
+		return nil
+	}
+}
+
+// WithKeyFile reads the key signing logins from a PEM encoded PKCS#1 file.
+func WithKeyFile(path string) Option {
+	return func(o *options) error {
+		o.keyFile = path
+		return nil
+	}
+}
+
+// WithDirectory sets the directory modules write local files to, the working directory by default.
+func WithDirectory(directory string) Option {
+	return func(o *options) error {
+		o.directory = directory
+		return nil
+	}
+}
+
+// WithConnection sets timeouts, retries, the proxy and the transport, like the connection section
+// of the configuration file does for the CLI. The settings only apply to this client.
+func WithConnection(settings service.ConnectionConfiguration) Option {
+	return func(o *options) error {
+		o.connection = &settings
+		return nil
+	}
+}
+
+// WithWorkers sets the amount of files downloaded in parallel by a module.
+func WithWorkers(workers int) Option {
+	return func(o *options) error {
+		if workers <= 0 {
+			return errors.New("workers must be positive")
+		}
+		o.workers = workers
+		return nil
+	}
+}
+
+// WithMaxRate caps the download rate shared by all transfers.
+func WithMaxRate(rate bandwidth.Rate) Option {
+	return func(o *options) error {
+		o.maxRate = rate
+		return nil
+	}
+}
+
+// WithLogger sets the logger, nothing is logged by default.
+func WithLogger(logger *slog.Logger) Option {
+	return func(o *options) error {
+		o.logger = logger
+		return nil
+	}
+}
+
+// WithProgress sets a callback receiving the progress of synchronizations. It is called from the
+// goroutines doing the transfers, so it must be safe for concurrent use.
+func WithProgress(progress func(Progress)) Option {
+	return func(o *options) error {
+		o.progress = progress
+		return nil
+	}
+}
+
+// New returns a client for the configured server. It does not contact the server yet.
+func New(opts ...Option) (*Client, error) {
+	o := options{workers: appclient.DefaultWorkers}
+	for _, opt := range opts {
+		err := opt(&o)
+		if err != nil {
+			return nil, err
+		}
+	}
+	configuration := &service.AppConfiguration{}
+	if o.configuration != nil {
+		copied := *o.configuration
+		configuration = &copied
+	}
+	configuration.Mode = appclient.Type
+	if o.serverUrl != "" {
+		configuration.ServerUrl = o.serverUrl
+	}
+	if o.username != "" {
+		configuration.Username = o.username
+	}
+	if configuration.Username == "" {
+		return nil, errors.New("no username configured")
+	}
+	if o.connection != nil {
+		configuration.Connection = *o.connection
+	}
+	key := o.key
+	if key == nil && o.keyFile != "" {
+		var err error
+		key, err = service.LoadPrivateKey(o.keyFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+	logger := o.logger
+	if logger == nil {
+		logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+	c := &appclient.Client{
+		Configuration: configuration,
+		Workers:       o.workers,
+		MaxRate:       o.maxRate,
+		PrivateKey:    key,
+		Directory:     o.directory,
+		Progress:      o.progress,
+		Logger:        logger,
+	}
+	err := c.Connect()
+	if err != nil {
+		return nil, err
+	}
+	return &Client{client: c}, nil
+}
+
+// Login performs the protocol handshake and signs in, unless the client holds a valid session.
+// Sync signs in on its own, Login reports wrong credentials or an incompatible server early.
+func (c *Client) Login(ctx context.Context) error {
+	return c.client.Login(ctx)
+}
+
+// Sync synchronizes a single module. Errors returned by the server are *service.Error values,
+// comparable with errors.Is to service.ErrUnauthorized and the other sentinel errors.
+func (c *Client) Sync(ctx context.Context, module string) error {
+	return c.client.SyncModule(ctx, module)
+}
+
+// SyncAll synchronizes every module enabled in the configuration, continuing past failing ones.
+func (c *Client) SyncAll(ctx context.Context) error {
+	modules := c.client.Configuration.EnabledModules()
+	if len(modules) == 0 {
+		return errors.New("no modules enabled")
+	}
+	var errs []error
+	for _, module := range modules {
+		err := c.Sync(ctx, module.ID)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("module %s: %w", module.ID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close releases the connection to the server.
+func (c *Client) Close() error {
+	return c.client.Close()
+}
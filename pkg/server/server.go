@@ -0,0 +1,276 @@
+// Package server embeds a lazysync server in other Go programs. It serves the same JSON-RPC
+// methods, module web services and gRPC services as "lazysync run", either on its own listeners
+// or mounted on the HTTP server of the embedding program:
+//
+//	srv, err := server.New(
+//		server.WithConfigFile("/etc/app/lazysync.yaml"),
+//		server.WithKeyDirectory("/etc/app/keys"),
+//		server.WithModule(&reportModule{}, nil),
+//	)
+//	if err != nil {
+//		return err
+//	}
+//	err = srv.Start(ctx)
+//	if err != nil {
+//		return err
+//	}
+//	defer srv.Stop(context.Background())
+//	srv.Mount(mux, "/sync")
+//
+// Clients of a mounted server include the prefix in their server url, e.g. http://host/sync.
+package server
+
+import (
+	"context"
+	"errors"
+	"google.golang.org/grpc"
+	appserver "lazysync/application/server"
+	"lazysync/application/service"
+	"lazysync/modules"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// KeyStore provides the public keys users sign their logins with.
+type KeyStore = appserver.KeyStore
+
+// SessionStore keeps the sessions of signed in users, see WithSessionStore.
+type SessionStore = appserver.SessionStore
+
+// NewFileKeyStore reads keys from <directory>/<username>/key.rsa.pub, the layout written by setup.
+func NewFileKeyStore(directory string) KeyStore {
+	return appserver.NewFileKeyStore(directory)
+}
+
+// NewMemorySessionStore keeps sessions in memory, the default.
+func NewMemorySessionStore() SessionStore {
+	return appserver.NewMemorySessionStore()
+}
+
+// Server is an embedded lazysync server.
+type Server struct {
+	server  *appserver.Server
+	started bool
+}
+
+type options struct {
+	configuration *service.AppConfiguration
+	address       string
+	grpcAddress   string
+	grpcTLS       *service.TLSConfiguration
+	keys          KeyStore
+	sessions      SessionStore
+	modules       []moduleOption
+	logger        *slog.Logger
+}
+
+type moduleOption struct {
+	module modules.Module
+	config any
+}
+
+// Option configures a Server.
+type Option func(o *options) error
+
+// WithConfigFile reads the settings from a lazysync configuration file, other options override them.
+func WithConfigFile(path string) Option {
+	return func(o *options) error {
+		contents, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		o.configuration, err = service.ParseConfiguration(contents)
+		return err
+	}
+}
+
+// WithConfiguration uses an already loaded configuration, other options override its settings.
+func WithConfiguration(configuration *service.AppConfiguration) Option {
+	return func(o *options) error {
+		o.configuration = configuration
+		return nil
+	}
+}
+
+// WithAddress sets the address ListenAndServe listens on, host:port or unix:///path.
+func WithAddress(address string) Option {
+	return func(o *options) error {
+		o.address = address
+		return nil
+	}
+}
+
+// WithGRPCAddress enables the gRPC services, served on address by ListenAndServe. They need
+// WithGRPCTLS, unless the configuration sets up TLS.
+func WithGRPCAddress(address string) Option {
+	return func(o *options) error {
+		o.grpcAddress = address
+		return nil
+	}
+}
+
+// WithGRPCTLS sets the certificate of the gRPC services, or allows plaintext with Insecure.
+func WithGRPCTLS(settings service.TLSConfiguration) Option {
+	return func(o *options) error {
+		o.grpcTLS = &settings
+		return nil
+	}
+}
+
+// WithKeyStore sets where the public keys of the users come from.
+func WithKeyStore(keys KeyStore) Option {
+	return func(o *options) error {
+		o.keys = keys
+		return nil
+	}
+}
+
+// WithKeyDirectory reads the public keys of the users from directory, instead of private/keys in
+// the working directory.
+func WithKeyDirectory(directory string) Option {
+	return WithKeyStore(NewFileKeyStore(directory))
+}
+
+// WithSessionStore sets where sessions are kept. Stores shared by several servers let clients
+// sign in on one of them and synchronize with another.
+func WithSessionStore(sessions SessionStore) Option {
+	return func(o *options) error {
+		o.sessions = sessions
+		return nil
+	}
+}
+
+// WithModule serves a module implemented by the embedding program, replacing a built-in module
+// with the same id, and enables it. config is handed to SetConfiguration, the current values of
+// the module are kept when nil. Start fails when the module rejects it. Group specific
+// configuration still comes from the configuration.
+func WithModule(module modules.Module, config any) Option {
+	return func(o *options) error {
+		if module == nil || module.GetId() == "" {
+			return errors.New("module without id")
+		}
+		o.modules = append(o.modules, moduleOption{module: module, config: config})
+		return nil
+	}
+}
+
+// WithLogger sets the logger, slog.Default() by default.
+func WithLogger(logger *slog.Logger) Option {
+	return func(o *options) error {
+		o.logger = logger
+		return nil
+	}
+}
+
+// New returns a server configured by the options, Start or ListenAndServe make it serve requests.
+func New(opts ...Option) (*Server, error) {
+	o := options{logger: slog.Default()}
+	for _, opt := range opts {
+		err := opt(&o)
+		if err != nil {
+			return nil, err
+		}
+	}
+	configuration := &service.AppConfiguration{}
+	if o.configuration != nil {
+		copied := *o.configuration
+		copied.Modules = append([]service.ModuleConfiguration(nil), o.configuration.Modules...)
+		configuration = &copied
+	}
+	configuration.Mode = appserver.Type
+	configuration.Username = appserver.Type
+	if o.address != "" {
+		configuration.Server.Address = o.address
+	}
+	if o.grpcAddress != "" {
+		configuration.Server.GRPCAddress = o.grpcAddress
+	}
+	if o.grpcTLS != nil {
+		configuration.Server.GRPCTLS = *o.grpcTLS
+	}
+	s := &appserver.Server{
+		Configuration: configuration,
+		Keys:          o.keys,
+		Sessions:      o.sessions,
+		Logger:        o.logger,
+	}
+	for _, m := range o.modules {
+		config := m.config
+		if config == nil {
+			config = m.module.GetConfigurationValues()
+		}
+		configuration.EnableModule(m.module.GetId(), config)
+		s.ExtraModules = append(s.ExtraModules, m.module)
+	}
+	return &Server{server: s}, nil
+}
+
+// Start sets up the enabled modules and the handlers. Modules running background work keep it
+// running until Stop, event streams are closed once ctx is done.
+func (s *Server) Start(ctx context.Context) error {
+	if s.started {
+		return errors.New("server already started")
+	}
+	err := s.server.Init(ctx)
+	if err != nil {
+		return err
+	}
+	s.started = true
+	return nil
+}
+
+// Handler serves the JSON-RPC methods, module web services, events, metrics and health checks.
+// It is nil until Start succeeded.
+func (s *Server) Handler() http.Handler {
+	return s.server.Handler()
+}
+
+// Mount serves the handler below prefix on mux, e.g. "/sync". Clients send JSON-RPC calls to the
+// prefix itself, which a plain http.StripPrefix mount would redirect.
+func (s *Server) Mount(mux *http.ServeMux, prefix string) {
+	prefix = strings.TrimSuffix(prefix, "/")
+	handler := s.Handler()
+	if prefix == "" {
+		mux.Handle("/", handler)
+		return
+	}
+	mounted := http.StripPrefix(prefix, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "" {
+			r.URL.Path = "/"
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	mux.Handle(prefix, mounted)
+	mux.Handle(prefix+"/", mounted)
+}
+
+// GRPCServer returns the gRPC server to serve on a listener of the embedding program, nil unless
+// a gRPC address is configured.
+func (s *Server) GRPCServer() *grpc.Server {
+	return s.server.GRPCServer()
+}
+
+// ListenAndServe starts the server unless already started and serves on the configured addresses
+// until ctx is done. It then waits for active transfers and stops the server.
+func (s *Server) ListenAndServe(ctx context.Context) error {
+	if !s.started {
+		err := s.Start(ctx)
+		if err != nil {
+			return err
+		}
+	}
+	err := s.server.Serve(ctx)
+	s.started = false
+	return err
+}
+
+// Stop stops the modules and closes the audit log of a started server serving through Handler.
+// Stop it once the HTTP server mounting the handler shut down, it can be started again afterwards.
+func (s *Server) Stop(ctx context.Context) {
+	if s.started {
+		s.server.Stop(ctx)
+		s.started = false
+	}
+}
@@ -0,0 +1,171 @@
+package server
+
+import (
+	"context"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/rpc/v2"
+	"io"
+	"lazysync/application/service"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// PathModule answers GET /path-module/path and the JSON-RPC method PathModule.Path with the path of
+// the request it handles. It is exported as the server registers it as JSON-RPC service.
+type PathModule struct{}
+
+func (PathModule) GetId() string                                             { return "path-module" }
+func (PathModule) SetupModule()                                              {}
+func (PathModule) GetConfigurationValues() interface{}                       { return map[string]any{} }
+func (PathModule) SetConfiguration(interface{}) error                        { return nil }
+func (PathModule) Sync(*service.Principal) service.SyncObject                { return &service.BaseSyncObject{} }
+func (PathModule) GetSyncObjectInstance() service.SyncObject                 { return &service.BaseSyncObject{} }
+func (PathModule) ExecuteCommands(context.Context, service.SyncObject) error { return nil }
+
+func (PathModule) Path(r *http.Request, _ *struct{}, reply *string) error {
+	*reply = r.URL.Path
+	return nil
+}
+
+func (PathModule) RegisterAsWebService(router *mux.Router, _ *rpc.Server) {
+	router.HandleFunc("/path-module/path", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.URL.Path)
+	}).Methods(http.MethodGet)
+}
+
+// LifecycleModule is a PathModule counting how often it was started and stopped.
+type LifecycleModule struct {
+	PathModule
+	starts, stops int
+}
+
+func (m *LifecycleModule) Start(context.Context) error {
+	m.starts++
+	return nil
+}
+
+func (m *LifecycleModule) Stop(context.Context) error {
+	m.stops++
+	return nil
+}
+
+func startServer(t *testing.T) *Server {
+	t.Helper()
+	configuration := &service.AppConfiguration{}
+	configuration.Server.AuditLog = filepath.Join(t.TempDir(), "audit.log")
+	srv, err := New(
+		WithConfiguration(configuration),
+		WithKeyDirectory(t.TempDir()),
+		WithModule(PathModule{}, nil),
+		WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	err = srv.Start(ctx)
+	if err != nil {
+		cancel()
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		cancel()
+		srv.Stop(context.Background())
+	})
+	return srv
+}
+
+func TestMount(t *testing.T) {
+	srv := startServer(t)
+	call := `{"jsonrpc": "2.0", "id": "1", "method": "PathModule.Path", "params": [{}]}`
+	type request struct {
+		method string
+		path   string
+		status int
+		body   string // Expected prefix of the response body.
+	}
+	tests := []struct {
+		name     string
+		prefix   string
+		requests []request
+	}{
+		{"prefix", "/sync", []request{
+			{http.MethodPost, "/sync", http.StatusOK, `{"jsonrpc":"2.0","result":"/"`},
+			{http.MethodPost, "/sync/", http.StatusOK, `{"jsonrpc":"2.0","result":"/"`},
+			{http.MethodGet, "/sync/healthz", http.StatusOK, `{"status":"ok"`},
+			{http.MethodGet, "/sync/path-module/path", http.StatusOK, "/path-module/path"},
+			{http.MethodGet, "/healthz", http.StatusNotFound, ""},
+			{http.MethodGet, "/syncer/healthz", http.StatusNotFound, ""},
+		}},
+		{"trailing slash", "/sync/", []request{
+			{http.MethodPost, "/sync", http.StatusOK, `{"jsonrpc":"2.0","result":"/"`},
+			{http.MethodGet, "/sync/healthz", http.StatusOK, `{"status":"ok"`},
+		}},
+		{"nested prefix", "/api/sync", []request{
+			{http.MethodPost, "/api/sync", http.StatusOK, `{"jsonrpc":"2.0","result":"/"`},
+			{http.MethodGet, "/api/sync/path-module/path", http.StatusOK, "/path-module/path"},
+			{http.MethodGet, "/api/healthz", http.StatusNotFound, ""},
+		}},
+		{"root", "/", []request{
+			{http.MethodPost, "/", http.StatusOK, `{"jsonrpc":"2.0","result":"/"`},
+			{http.MethodGet, "/healthz", http.StatusOK, `{"status":"ok"`},
+			{http.MethodGet, "/path-module/path", http.StatusOK, "/path-module/path"},
+		}},
+		{"empty", "", []request{
+			{http.MethodPost, "/", http.StatusOK, `{"jsonrpc":"2.0","result":"/"`},
+			{http.MethodGet, "/healthz", http.StatusOK, `{"status":"ok"`},
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			srv.Mount(mux, test.prefix)
+			for _, request := range test.requests {
+				var body io.Reader
+				if request.method == http.MethodPost {
+					body = strings.NewReader(call)
+				}
+				r := httptest.NewRequest(request.method, request.path, body)
+				r.Header.Set("Content-Type", "application/json")
+				w := httptest.NewRecorder()
+				mux.ServeHTTP(w, r)
+				if w.Code != request.status {
+					t.Errorf("%s %s: status %d, want %d", request.method, request.path, w.Code, request.status)
+					continue
+				}
+				if !strings.HasPrefix(w.Body.String(), request.body) {
+					t.Errorf("%s %s: body %q, want prefix %q", request.method, request.path, w.Body.String(), request.body)
+				}
+			}
+		})
+	}
+}
+
+func TestRestart(t *testing.T) {
+	module := &LifecycleModule{}
+	configuration := &service.AppConfiguration{}
+	configuration.Server.AuditLog = filepath.Join(t.TempDir(), "audit.log")
+	srv, err := New(
+		WithConfiguration(configuration),
+		WithKeyDirectory(t.TempDir()),
+		WithModule(module, nil),
+		WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 3; i++ {
+		err = srv.Start(context.Background())
+		if err != nil {
+			t.Fatalf("start %d: %v", i, err)
+		}
+		srv.Stop(context.Background())
+		if module.starts != i || module.stops != i {
+			t.Fatalf("after %d restarts the module was started %d and stopped %d times", i, module.starts, module.stops)
+		}
+	}
+}